@@ -0,0 +1,147 @@
+package account
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/email"
+	"backend/identity"
+	"backend/model"
+	"backend/profile"
+	"backend/sso"
+	"backend/validation"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// DeleteHandler deletes the logged-in user's account after checking their password
+// (see profile.Reauthenticate): every document below the user (events, journals and
+// their revisions, keys, audit log), the user's friend documents, shares and linked
+// OpenID Connect accounts, and finally the user document and its email address. A
+// confirmation is sent to that address.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.AccountDeleteRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !profile.Reauthenticate(w, userID, request.Password, request.EmailCode) {
+		return
+	}
+
+	userRef := identity.UserRef(userID)
+	doc, err := userRef.Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	address, _ := doc.Data()["Email"].(string)
+	lang := email.UserLanguage(doc)
+
+	// The user document goes last, so a failed deletion can be retried by logging in again
+	if err := deleteAccountData(userID); err != nil {
+		log.Printf("Failed to delete data of user %s: %v", userID, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to delete account")
+		return
+	}
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if address != "" {
+			if err := identity.Release(tx, address); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(userRef)
+	})
+	if err != nil {
+		log.Printf("Failed to delete user %s: %v", userID, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to delete account")
+		return
+	}
+	log.Printf("Deleted account %s", userID)
+
+	if address != "" {
+		if err := email.Send(address, lang, "account_deleted", nil); err != nil {
+			log.Printf("Failed to send account deletion confirmation to %s: %v", address, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+}
+
+// deleteAccountData removes everything that belongs to or refers to the user, except
+// the user document itself
+func deleteAccountData(userID string) error {
+	if err := deleteDescendants(identity.UserRef(userID)); err != nil {
+		return err
+	}
+
+	if err := sso.UnlinkUser(userID); err != nil {
+		return err
+	}
+
+	friends := db.Client.Collection("friends")
+	for _, query := range []firestore.Query{
+		friends.Where("UserID", "==", userID),
+		friends.Where("FriendID", "==", userID),
+	} {
+		docs, err := query.Documents(db.Ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if _, err := doc.Ref.Delete(db.Ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	shared, err := db.Client.CollectionGroup("journals").Where("SharedWith", "array-contains", userID).Documents(db.Ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range shared {
+		update := firestore.Update{Path: "SharedWith", Value: firestore.ArrayRemove(userID)}
+		if _, err := doc.Ref.Update(db.Ctx, []firestore.Update{update}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteDescendants deletes every document in the subcollections below ref, at any
+// depth. Firestore does not delete subcollections together with their parent.
+func deleteDescendants(ref *firestore.DocumentRef) error {
+	collections := ref.Collections(db.Ctx)
+	for {
+		collection, err := collections.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		docs, err := collection.DocumentRefs(db.Ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := deleteDescendants(doc); err != nil {
+				return err
+			}
+			if _, err := doc.Delete(db.Ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package account
+
+import (
+	"archive/zip"
+	"backend/apierror"
+	"backend/db"
+	"backend/identity"
+	"backend/journal"
+	"backend/model"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Export is everything stored about a user, as downloaded from GET /api/v1/account/export
+type Export struct {
+	ExportedAt time.Time          `json:"exportedAt"`
+	UserID     string             `json:"userID"`
+	Profile    model.Profile      `json:"profile"`
+	Events     []model.Event      `json:"events"`
+	Journals   []model.Journal    `json:"journals"`
+	Friends    []Friendship       `json:"friends"`
+	Audit      []model.AuditEntry `json:"audit"`
+}
+
+// Friendship is a friend document as seen by the exporting user
+type Friendship struct {
+	Username  string `json:"username"`
+	Status    string `json:"status"`    // "pending" or "accepted"
+	Direction string `json:"direction"` // "sent" or "received"
+}
+
+// ExportHandler downloads the logged-in user's data. format=json (default) gives a single
+// JSON file; format=zip gives a zip with one JSON file per part of the export.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidRequest, "Invalid format. Use json or zip.")
+		return
+	}
+
+	export, err := collectExport(userID)
+	if err != nil {
+		log.Printf("Failed to export account %s: %v", userID, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to export account data")
+		return
+	}
+
+	filename := "dailyverse-account-" + export.ExportedAt.Format("2006-01-02")
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	if err := writeZip(w, export); err != nil {
+		// Headers are already sent once streaming starts, so a failure can only be logged
+		log.Printf("Failed to write account export for %s: %v", userID, err)
+	}
+}
+
+// writeZip writes each part of the export as its own JSON file
+func writeZip(w io.Writer, export *Export) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", struct {
+			ExportedAt time.Time     `json:"exportedAt"`
+			UserID     string        `json:"userID"`
+			Profile    model.Profile `json:"profile"`
+		}{export.ExportedAt, export.UserID, export.Profile}},
+		{"events.json", export.Events},
+		{"journals.json", export.Journals},
+		{"friends.json", export.Friends},
+		{"audit.json", export.Audit},
+	}
+	for _, f := range files {
+		file, err := archive.Create(f.name)
+		if err != nil {
+			archive.Close()
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(f.data); err != nil {
+			archive.Close()
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// collectExport reads the user's profile, events, decrypted journal entries, friend
+// documents and audit log
+func collectExport(userID string) (*Export, error) {
+	userRef := identity.UserRef(userID)
+	doc, err := userRef.Get(db.Ctx)
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := doc.DataTo(&user); err != nil {
+		return nil, err
+	}
+
+	export := &Export{
+		ExportedAt: time.Now().UTC(),
+		UserID:     userID,
+		Profile: model.Profile{
+			Username:    user.Username,
+			Email:       user.Email,
+			Country:     user.Country,
+			CountryCode: user.CountryCode,
+			City:        user.City,
+			FirstName:   user.FirstName,
+			LastName:    user.LastName,
+			ImageURL:    user.ImageURL,
+		},
+		Events:   []model.Event{},
+		Journals: []model.Journal{},
+		Friends:  []Friendship{},
+		Audit:    []model.AuditEntry{},
+	}
+
+	eventDocs, err := userRef.Collection("events").Documents(db.Ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range eventDocs {
+		var event model.Event
+		if err := doc.DataTo(&event); err != nil {
+			return nil, err
+		}
+		event.EventID = doc.Ref.ID
+		event.Email = user.Email
+		export.Events = append(export.Events, event)
+	}
+
+	journals, err := journal.ListJournals(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Journals = append(export.Journals, journals...)
+
+	if export.Friends, err = collectFriendships(userID); err != nil {
+		return nil, err
+	}
+
+	auditDocs, err := userRef.Collection("audit").OrderBy("At", firestore.Asc).Documents(db.Ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range auditDocs {
+		var entry model.AuditEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, err
+		}
+		export.Audit = append(export.Audit, entry)
+	}
+	return export, nil
+}
+
+// collectFriendships lists the friend documents the user is part of, naming the other
+// user by username
+func collectFriendships(userID string) ([]Friendship, error) {
+	friends := db.Client.Collection("friends")
+	sent, err := friends.Where("UserID", "==", userID).Documents(db.Ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	received, err := friends.Where("FriendID", "==", userID).Documents(db.Ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	friendships := []Friendship{}
+	var refs []*firestore.DocumentRef
+	for _, doc := range append(sent, received...) {
+		var friend model.Friend
+		if err := doc.DataTo(&friend); err != nil {
+			return nil, err
+		}
+		friendship := Friendship{Status: friend.Status, Direction: "sent"}
+		otherID := friend.FriendID
+		if friend.FriendID == userID {
+			friendship.Direction, otherID = "received", friend.UserID
+		}
+		friendships = append(friendships, friendship)
+		refs = append(refs, identity.UserRef(otherID))
+	}
+	if len(refs) == 0 {
+		return friendships, nil
+	}
+
+	others, err := db.Client.GetAll(db.Ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range others {
+		if doc.Exists() {
+			friendships[i].Username, _ = doc.Data()["Username"].(string)
+		}
+	}
+	return friendships, nil
+}
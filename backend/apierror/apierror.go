@@ -0,0 +1,51 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID of a request in both directions; it is set on every
+// response by middleware.RequestIDMiddleware
+const RequestIDHeader = "X-Request-ID"
+
+// Error is the JSON body of every error response. Code is stable and meant for
+// programs, Message is meant for people and may change.
+type Error struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   []FieldError           `json:"details,omitempty"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	RequestID string                 `json:"requestId,omitempty"`
+}
+
+// FieldError points at one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Write sends an error response with the given status, code and message
+func Write(w http.ResponseWriter, status int, code, message string) {
+	WriteError(w, status, &Error{Code: code, Message: message})
+}
+
+// WriteDetails sends a validation error listing the fields that were rejected
+func WriteDetails(w http.ResponseWriter, status int, code, message string, details []FieldError) {
+	WriteError(w, status, &Error{Code: code, Message: message, Details: details})
+}
+
+// WriteError sends e with the given status, stamped with the request's ID
+func WriteError(w http.ResponseWriter, status int, e *Error) {
+	if e.RequestID == "" {
+		e.RequestID = w.Header().Get(RequestIDHeader)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
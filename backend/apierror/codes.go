@@ -0,0 +1,70 @@
+package apierror
+
+// Error codes. Clients match on these, so existing values must not change.
+const (
+	// Generic
+	InvalidRequest   = "INVALID_REQUEST"
+	InvalidBody      = "INVALID_BODY"
+	MissingParameter = "MISSING_PARAMETER"
+	ValidationFailed = "VALIDATION_FAILED"
+	InvalidDate      = "INVALID_DATE"
+	InvalidTime      = "INVALID_TIME"
+	InvalidTimeZone  = "INVALID_TIME_ZONE"
+	Unauthorized     = "UNAUTHORIZED"
+	TokenMissing     = "TOKEN_MISSING"
+	TokenInvalid     = "TOKEN_INVALID"
+	Forbidden        = "FORBIDDEN"
+	NotFound         = "NOT_FOUND"
+	RouteNotFound    = "ROUTE_NOT_FOUND"
+	MethodNotAllowed = "METHOD_NOT_ALLOWED"
+	Conflict         = "CONFLICT"
+	PayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	RateLimited      = "RATE_LIMITED"
+	InternalError    = "INTERNAL_ERROR"
+	UpstreamError    = "UPSTREAM_ERROR"
+
+	// Accounts
+	UserNotFound           = "USER_NOT_FOUND"
+	InvalidCredentials     = "INVALID_CREDENTIALS"
+	AccountLocked          = "ACCOUNT_LOCKED"
+	EmailNotVerified       = "EMAIL_NOT_VERIFIED"
+	EmailAlreadyRegistered = "EMAIL_ALREADY_REGISTERED"
+	AlreadyVerified        = "ALREADY_VERIFIED"
+	InvalidOTP             = "INVALID_OTP"
+	OTPExpired             = "OTP_EXPIRED"
+	OTPAttemptsExceeded    = "OTP_ATTEMPTS_EXCEEDED"
+	InvalidLink            = "INVALID_LINK"
+	LinkExpired            = "LINK_EXPIRED"
+	ReauthCodeRequired     = "REAUTH_CODE_REQUIRED"
+	WeakPassword           = "WEAK_PASSWORD"
+	InvalidCountry         = "INVALID_COUNTRY"
+	MFARequired            = "MFA_REQUIRED"
+	InvalidMFACode         = "INVALID_MFA_CODE"
+	MFAAlreadyEnabled      = "MFA_ALREADY_ENABLED"
+	MFANotEnabled          = "MFA_NOT_ENABLED"
+	InvalidPasskey         = "INVALID_PASSKEY"
+	PasskeyNotFound        = "PASSKEY_NOT_FOUND"
+	PasskeySessionInvalid  = "PASSKEY_SESSION_INVALID"
+	OIDCProviderUnknown    = "OIDC_PROVIDER_UNKNOWN"
+	OIDCStateInvalid       = "OIDC_STATE_INVALID"
+	OIDCLoginFailed        = "OIDC_LOGIN_FAILED"
+	OIDCEmailNotVerified   = "OIDC_EMAIL_NOT_VERIFIED"
+
+	// Events
+	EventNotFound     = "EVENT_NOT_FOUND"
+	EventAccessDenied = "EVENT_ACCESS_DENIED"
+	InvalidEventType  = "INVALID_EVENT_TYPE"
+
+	// Friends
+	FriendRequestNotFound = "FRIEND_REQUEST_NOT_FOUND"
+	FriendRequestExists   = "FRIEND_REQUEST_EXISTS"
+	SelfFriendRequest     = "SELF_FRIEND_REQUEST"
+	NotFriends            = "NOT_FRIENDS"
+
+	// Journals
+	JournalNotFound   = "JOURNAL_NOT_FOUND"
+	RevisionNotFound  = "REVISION_NOT_FOUND"
+	JournalExists     = "JOURNAL_EXISTS"
+	DuplicateJournals = "DUPLICATE_JOURNALS"
+	VersionMismatch   = "VERSION_MISMATCH"
+)
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/model"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Actions recorded in the audit log
+const (
+	ProfileUpdate        = "profile.update"
+	PasswordChange       = "password.change"
+	EmailChangeRequested = "email.change_requested"
+	EmailChange          = "email.change"
+	MFAEnable            = "mfa.enable"
+	MFADisable           = "mfa.disable"
+	RecoveryCodesRenew   = "mfa.recovery_codes_renew"
+	RecoveryCodeUsed     = "mfa.recovery_code_used"
+	PasskeyAdd           = "passkey.add"
+	PasskeyRemove        = "passkey.remove"
+	OIDCLink             = "oidc.link"
+)
+
+// Add writes an audit entry for the user in the same transaction as the change it
+// records, so a change is never saved without its entry
+func Add(tx *firestore.Transaction, r *http.Request, userID, action string, fields ...string) error {
+	requestID, _ := r.Context().Value("requestID").(string)
+	entry := model.AuditEntry{
+		Action:    action,
+		Fields:    fields,
+		IP:        middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: requestID,
+		At:        time.Now().UTC(),
+	}
+	return tx.Create(db.Client.Collection("users").Doc(userID).Collection("audit").NewDoc(), entry)
+}
@@ -1,6 +1,7 @@
 package city
 
 import (
+	"backend/apierror"
 	"backend/model"
 	"bytes"
 	"encoding/json"
@@ -12,21 +13,21 @@ func GetCities(w http.ResponseWriter, r *http.Request) {
 	// Get the country parameter from the query string
 	country := r.URL.Query().Get("country")
 	if country == "" {
-		http.Error(w, "Missing country parameter", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing country parameter")
 		return
 	}
 
 	// Create the request body for the external API
 	requestBody, err := json.Marshal(model.CityRequest{Country: country})
 	if err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create request")
 		return
 	}
 
 	// Make a POST request to the external API
 	resp, err := http.Post("https://countriesnow.space/api/v0.1/countries/cities", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
-		http.Error(w, "Error fetching cities", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Error fetching cities")
 		return
 	}
 	defer resp.Body.Close()
@@ -34,14 +35,14 @@ func GetCities(w http.ResponseWriter, r *http.Request) {
 	// Read the response body
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		http.Error(w, "Error reading cities response", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Error reading cities response")
 		return
 	}
 
 	// Parse the response
 	var cityResponse model.CityResponse
 	if err := json.Unmarshal(body, &cityResponse); err != nil {
-		http.Error(w, "Error decoding cities response", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Error decoding cities response")
 		return
 	}
 
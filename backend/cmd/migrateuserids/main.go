@@ -0,0 +1,282 @@
+// Command migrateuserids moves users stored under their email address to a stable user
+// ID. Each old users/{email} document gets a UUID and is moved, together with its
+// events, journals, revisions, keys and audit log, to users/{userID}. Events and
+// journals name their owner by ID, friend documents and shared journals refer to both
+// users by ID, and the address is registered in the emails index.
+//
+// Run it once from the backend directory, before starting the new server:
+//
+//	go run ./cmd/migrateuserids -dry-run
+//	go run ./cmd/migrateuserids
+//
+// Users that are already migrated are skipped, so the command can be run again after
+// an interruption.
+package main
+
+import (
+	"backend/db"
+	"backend/identity"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without writing")
+	flag.Parse()
+
+	db.InitFirestore()
+	defer db.CloseFirestore()
+
+	// Collect the legacy documents first so the users created below aren't iterated over
+	var legacy []*firestore.DocumentRef
+	iter := db.Client.Collection("users").Documents(db.Ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Failed to list users: %v", err)
+		}
+		if strings.Contains(doc.Ref.ID, "@") {
+			legacy = append(legacy, doc.Ref)
+		}
+	}
+	iter.Stop()
+	log.Printf("Found %d users keyed by email", len(legacy))
+
+	failed := 0
+	for _, ref := range legacy {
+		userID, err := migrateUser(ref, *dryRun)
+		if err != nil {
+			log.Printf("Failed to migrate %s: %v", ref.ID, err)
+			failed++
+			continue
+		}
+		if userID != "" {
+			log.Printf("Migrated %s to %s", ref.ID, userID)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d users were not migrated", failed, len(legacy))
+	}
+	log.Println("Migration finished")
+}
+
+// migrateUser moves one user in a single transaction and returns the new user ID, or ""
+// if the document was already gone. References to users that haven't been migrated yet
+// keep their email and are rewritten when that user is migrated.
+func migrateUser(oldRef *firestore.DocumentRef, dryRun bool) (string, error) {
+	var userID string
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		userID = ""
+
+		// Firestore transactions must do every read before the first write
+		userDoc, err := tx.Get(oldRef)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		address := oldRef.ID
+		if _, err := tx.Get(identity.EmailRef(address)); err == nil {
+			return fmt.Errorf("%s is already registered in the emails index", address)
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+		descendants, err := collectDescendants(ctx, tx, oldRef)
+		if err != nil {
+			return err
+		}
+		sent, err := tx.Documents(db.Client.Collection("friends").Where("Email", "==", address)).GetAll()
+		if err != nil {
+			return err
+		}
+		received, err := tx.Documents(db.Client.Collection("friends").Where("FriendEmail", "==", address)).GetAll()
+		if err != nil {
+			return err
+		}
+		shared, err := tx.Documents(db.Client.CollectionGroup("journals").Where("SharedWith", "array-contains", address)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		// Other users referred to by email, mapped to their ID once they are migrated
+		ids := map[string]string{}
+		for _, doc := range append(sent, received...) {
+			for _, field := range []string{"Email", "FriendEmail"} {
+				if other, _ := doc.Data()[field].(string); other != "" && other != address {
+					ids[other] = ""
+				}
+			}
+		}
+		for _, doc := range descendants {
+			for _, other := range sharedWith(doc) {
+				if strings.Contains(other, "@") {
+					ids[other] = ""
+				}
+			}
+		}
+		for other := range ids {
+			doc, err := tx.Get(identity.EmailRef(other))
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ids[other], _ = doc.Data()["UserID"].(string)
+		}
+
+		userID = identity.NewUserID()
+		ids[address] = userID
+		if dryRun {
+			log.Printf("Would move %s to %s with %d documents, %d friend documents and %d shared journals",
+				address, userID, len(descendants), len(sent)+len(received), len(shared))
+			return nil
+		}
+
+		user := userDoc.Data()
+		user["UserID"] = userID
+		if _, ok := user["Email"]; !ok {
+			user["Email"] = address
+		}
+		if err := tx.Create(identity.UserRef(userID), user); err != nil {
+			return err
+		}
+		if err := identity.Reserve(tx, address, userID); err != nil {
+			return err
+		}
+		if err := tx.Delete(oldRef); err != nil {
+			return err
+		}
+
+		for _, doc := range descendants {
+			data := doc.Data()
+			if _, ok := data["Email"]; ok {
+				delete(data, "Email")
+				data["UserID"] = userID
+			}
+			if _, ok := data["SharedWith"]; ok {
+				data["SharedWith"] = replaceEmails(sharedWith(doc), ids)
+			}
+			if err := tx.Set(rebase(doc.Ref, oldRef, identity.UserRef(userID)), data); err != nil {
+				return err
+			}
+			if err := tx.Delete(doc.Ref); err != nil {
+				return err
+			}
+		}
+
+		for _, doc := range append(sent, received...) {
+			if err := migrateFriend(tx, doc, ids); err != nil {
+				return err
+			}
+		}
+
+		for _, doc := range shared {
+			if doc.Ref.Parent.Parent.Path == oldRef.Path {
+				continue // moved with the descendants above
+			}
+			update := firestore.Update{Path: "SharedWith", Value: replaceEmails(sharedWith(doc), ids)}
+			if err := tx.Update(doc.Ref, []firestore.Update{update}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return userID, err
+}
+
+// migrateFriend rewrites a friend document with the user IDs known so far. Once both
+// users have an ID the document moves to its new key, {userID}_{friendID}.
+func migrateFriend(tx *firestore.Transaction, doc *firestore.DocumentSnapshot, ids map[string]string) error {
+	data := doc.Data()
+	for from, to := range map[string]string{"Email": "UserID", "FriendEmail": "FriendID"} {
+		if email, _ := data[from].(string); ids[email] != "" {
+			delete(data, from)
+			data[to] = ids[email]
+		}
+	}
+
+	userID, _ := data["UserID"].(string)
+	friendID, _ := data["FriendID"].(string)
+	if userID == "" || friendID == "" {
+		return tx.Set(doc.Ref, data)
+	}
+	if err := tx.Set(db.Client.Collection("friends").Doc(userID+"_"+friendID), data); err != nil {
+		return err
+	}
+	return tx.Delete(doc.Ref)
+}
+
+// sharedWith returns the SharedWith list of a journal document
+func sharedWith(doc *firestore.DocumentSnapshot) []string {
+	values, _ := doc.Data()["SharedWith"].([]interface{})
+	var list []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// replaceEmails swaps the emails in list for the user IDs in ids where one is known
+func replaceEmails(list []string, ids map[string]string) []string {
+	replaced := make([]string, len(list))
+	for i, value := range list {
+		replaced[i] = value
+		if ids[value] != "" {
+			replaced[i] = ids[value]
+		}
+	}
+	return replaced
+}
+
+// collectDescendants reads every document in the subcollections below ref, at any depth
+func collectDescendants(ctx context.Context, tx *firestore.Transaction, ref *firestore.DocumentRef) ([]*firestore.DocumentSnapshot, error) {
+	var all []*firestore.DocumentSnapshot
+	collections := ref.Collections(ctx)
+	for {
+		collection, err := collections.Next()
+		if err == iterator.Done {
+			return all, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		docs, err := tx.Documents(collection).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			all = append(all, doc)
+			below, err := collectDescendants(ctx, tx, doc.Ref)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, below...)
+		}
+	}
+}
+
+// rebase returns the path of ref with its ancestor from replaced by to, e.g.
+// users/old/journals/1/revisions/2 becomes users/new/journals/1/revisions/2
+func rebase(ref, from, to *firestore.DocumentRef) *firestore.DocumentRef {
+	parent := ref.Parent.Parent
+	if parent.Path == from.Path {
+		return to.Collection(ref.Parent.ID).Doc(ref.ID)
+	}
+	return rebase(parent, from, to).Collection(ref.Parent.ID).Doc(ref.ID)
+}
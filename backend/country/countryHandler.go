@@ -1,6 +1,7 @@
 package country
 
 import (
+	"backend/apierror"
 	"backend/model"
 	"encoding/json"
 	"net/http"
@@ -10,7 +11,7 @@ import (
 func GetCountries(w http.ResponseWriter, r *http.Request) {
 	resp, err := http.Get("https://restcountries.com/v3.1/all")
 	if err != nil {
-		http.Error(w, "Error fetching countries", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Error fetching countries")
 		return
 	}
 	defer resp.Body.Close()
@@ -23,7 +24,7 @@ func GetCountries(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&countriesData); err != nil {
-		http.Error(w, "Error decoding response", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Error decoding response")
 		return
 	}
 
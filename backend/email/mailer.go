@@ -0,0 +1,174 @@
+package email
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Mailer hands a rendered email to a transport. Handlers don't call it directly: Send
+// puts the email in the outbox and the outbox worker calls the Mailer.
+type Mailer interface {
+	Deliver(to string, msg Message) error
+}
+
+var (
+	mailerOnce sync.Once
+	mailer     Mailer
+)
+
+// currentMailer returns the Mailer set with UseMailer, or else the one MAIL_TRANSPORT
+// names: smtp (default), file (writes .eml files to MAIL_DIR, default ./mail) or console
+func currentMailer() Mailer {
+	mailerOnce.Do(func() {
+		switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+		case "", "smtp":
+			mailer = SMTPMailer{}
+		case "file":
+			dir := os.Getenv("MAIL_DIR")
+			if dir == "" {
+				dir = "mail"
+			}
+			mailer = FileMailer{Dir: dir}
+		case "console":
+			mailer = ConsoleMailer{}
+		default:
+			log.Printf("Unknown MAIL_TRANSPORT %q; printing emails to the console", transport)
+			mailer = ConsoleMailer{}
+		}
+	})
+	return mailer
+}
+
+// UseMailer replaces the transport, e.g. with a MemoryMailer in tests. Call it before
+// any email is sent.
+func UseMailer(m Mailer) {
+	mailerOnce.Do(func() {})
+	mailer = m
+}
+
+// SMTPMailer sends through the server in SMTP_HOST and SMTP_PORT as EMAIL_USER. The
+// password is read from the EMAIL_PASS Docker secret or environment variable.
+type SMTPMailer struct{}
+
+func (SMTPMailer) Deliver(toEmail string, msg Message) error {
+	emailUser := os.Getenv("EMAIL_USER")
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPortStr := os.Getenv("SMTP_PORT")
+
+	var emailPass string
+
+	// Try to read EMAIL_PASS from Docker secret first
+	emailPassBytes, err := ioutil.ReadFile("/run/secrets/EMAIL_PASS")
+	if err == nil {
+		// Successfully read from Docker secret
+		emailPass = strings.TrimSpace(string(emailPassBytes))
+	} else if os.IsNotExist(err) {
+		// Secret file doesn't exist; try environment variable
+		emailPass = os.Getenv("EMAIL_PASS")
+		if emailPass == "" {
+			return fmt.Errorf("EMAIL_PASS is not set in environment variables")
+		}
+	} else {
+		// Some other error occurred
+		return fmt.Errorf("Failed to read EMAIL_PASS: %v", err)
+	}
+
+	smtpPort, err := strconv.Atoi(smtpPortStr)
+	if err != nil {
+		return fmt.Errorf("Invalid SMTP_PORT: %v", err)
+	}
+
+	d := gomail.NewDialer(smtpHost, smtpPort, emailUser, emailPass)
+	if err := d.DialAndSend(newMessage(emailUser, toEmail, msg)); err != nil {
+		return fmt.Errorf("Failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// FileMailer writes each email to Dir as an .eml file, which mail clients can open. For
+// development.
+type FileMailer struct {
+	Dir string
+}
+
+func (f FileMailer) Deliver(to string, msg Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFileName(to))
+	file, err := os.Create(filepath.Join(f.Dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = newMessage(os.Getenv("EMAIL_USER"), to, msg).WriteTo(file)
+	return err
+}
+
+// ConsoleMailer logs the text part of each email. For development.
+type ConsoleMailer struct{}
+
+func (ConsoleMailer) Deliver(to string, msg Message) error {
+	log.Printf("Email to %s\nSubject: %s\n\n%s", to, msg.Subject, msg.Text)
+	return nil
+}
+
+// SentEmail is an email a MemoryMailer received
+type SentEmail struct {
+	To string
+	Message
+}
+
+// MemoryMailer keeps the emails it is given, for tests
+type MemoryMailer struct {
+	mutex sync.Mutex
+	sent  []SentEmail
+}
+
+func (m *MemoryMailer) Deliver(to string, msg Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sent = append(m.sent, SentEmail{To: to, Message: msg})
+	return nil
+}
+
+// Sent returns the emails delivered so far, oldest first
+func (m *MemoryMailer) Sent() []SentEmail {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]SentEmail(nil), m.sent...)
+}
+
+// newMessage builds the MIME message: the text part with the HTML as an alternative
+func newMessage(from, to string, msg Message) *gomail.Message {
+	m := gomail.NewMessage()
+	if from != "" {
+		m.SetHeader("From", from)
+	}
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Text)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+	return m
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,69 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	var m MemoryMailer
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Deliver("user@example.com", Message{Subject: "Hello"})
+		}()
+	}
+	wg.Wait()
+
+	sent := m.Sent()
+	if len(sent) != 10 {
+		t.Fatalf("Sent() has %d emails, want 10", len(sent))
+	}
+	if sent[0].To != "user@example.com" || sent[0].Subject != "Hello" {
+		t.Errorf("Sent()[0] = %+v", sent[0])
+	}
+
+	// Sent returns a copy
+	sent[0].To = "changed"
+	if m.Sent()[0].To != "user@example.com" {
+		t.Error("changing the result of Sent() changed the mailer")
+	}
+}
+
+func TestUseMailer(t *testing.T) {
+	m := &MemoryMailer{}
+	UseMailer(m)
+	if currentMailer() != Mailer(m) {
+		t.Errorf("currentMailer() = %T, want the MemoryMailer", currentMailer())
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := FileMailer{Dir: dir}
+	if err := m.Deliver("user/name@example.com", Message{Subject: "Hello", Text: "Plain body", HTML: "<p>HTML body</p>"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), "-user_name@example.com.eml") {
+		t.Fatalf("FileMailer wrote %v, want one .eml file", files)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: user/name@example.com", "Subject: Hello", "Plain body", "<p>HTML body</p>"} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("email lacks %q:\n%s", want, raw)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package email
+
+import (
+	"backend/db"
+	"backend/model"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Delivery status of an outbox email
+const (
+	OutboxPending = "pending" // Waiting for its first or next attempt
+	OutboxSending = "sending" // Claimed by a worker
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed" // Given up on after MaxDeliveryAttempts
+)
+
+// MaxDeliveryAttempts is how often an email is tried before it is marked failed. With
+// the backoff below the last attempt is about an hour after the first.
+const MaxDeliveryAttempts = 8
+
+const (
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = time.Hour
+
+	// How long a claimed email is left to its worker before it is due again, in case
+	// that replica stopped halfway
+	sendingLease = 2 * time.Minute
+
+	outboxBatchSize    = 20
+	outboxPollInterval = 30 * time.Second
+
+	// How long sent and failed emails are kept for their delivery status
+	outboxRetention = 30 * 24 * time.Hour
+)
+
+// errNotDue aborts a claim when another worker got to the email first
+var errNotDue = errors.New("email not due")
+
+// wake tells RunOutbox an email was just queued, so it goes out without waiting for
+// the next poll
+var wake = make(chan struct{}, 1)
+
+func outbox() *firestore.CollectionRef {
+	return db.Client.Collection("outbox")
+}
+
+// Send renders the email called name in the given language and puts it in the outbox
+// for address. It returns once the email is stored; RunOutbox delivers it, retrying if
+// the transport fails, so a slow or unreachable mail server doesn't hold up requests.
+func Send(address, lang, name string, data map[string]interface{}) error {
+	msg, err := Render(name, lang, data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, _, err = outbox().Add(db.Ctx, model.OutboxEmail{
+		To:            address,
+		Template:      name,
+		Language:      Language(lang),
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		Status:        OutboxPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	notify()
+	return nil
+}
+
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOutbox delivers queued emails as they come in and retries failed ones when they
+// are due. It runs until the program exits; every replica may run it.
+func RunOutbox() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		DeliverDue()
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// DeliverDue makes one attempt at each email that is due, up to a batch
+func DeliverDue() {
+	docs, err := outbox().Where("NextAttemptAt", "<=", time.Now()).
+		OrderBy("NextAttemptAt", firestore.Asc).Limit(outboxBatchSize).Documents(db.Ctx).GetAll()
+	if err != nil {
+		log.Printf("Error listing outbox: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		deliver(doc.Ref)
+	}
+	if len(docs) == outboxBatchSize {
+		// There may be more; go again without waiting for the ticker
+		notify()
+	}
+}
+
+// deliver claims one email and hands it to the Mailer. The claim is a transaction, so
+// with several replicas only one of them sends it.
+func deliver(ref *firestore.DocumentRef) {
+	var email model.OutboxEmail
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&email); err != nil {
+			return err
+		}
+		updates, err := claim(&email, time.Now())
+		if err != nil {
+			return err
+		}
+		return tx.Update(ref, updates)
+	})
+	if err == errNotDue {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to claim email %s: %v", ref.ID, err)
+		return
+	}
+
+	err = currentMailer().Deliver(email.To, Message{Subject: email.Subject, Text: email.Text, HTML: email.HTML})
+	updates := outcome(email, err, time.Now())
+	switch {
+	case err == nil:
+	case email.Attempts >= MaxDeliveryAttempts:
+		log.Printf("Giving up on email %s (%s) to %s after %d attempts: %v", ref.ID, email.Template, email.To, email.Attempts, err)
+	default:
+		log.Printf("Failed to send email %s (%s) to %s, retrying in %v: %v", ref.ID, email.Template, email.To, retryDelay(email.Attempts), err)
+	}
+	if _, err := ref.Update(db.Ctx, updates); err != nil {
+		log.Printf("Failed to record delivery of email %s: %v", ref.ID, err)
+	}
+}
+
+// claim counts an attempt at email and returns the updates that mark it as being sent,
+// leased until sendingLease from now. It returns errNotDue if the email is done, or
+// claimed by another worker whose lease hasn't run out.
+func claim(email *model.OutboxEmail, now time.Time) ([]firestore.Update, error) {
+	if email.NextAttemptAt.IsZero() || email.NextAttemptAt.After(now) {
+		return nil, errNotDue
+	}
+	email.Attempts++
+	return []firestore.Update{
+		{Path: "Status", Value: OutboxSending},
+		{Path: "Attempts", Value: email.Attempts},
+		{Path: "NextAttemptAt", Value: now.Add(sendingLease)},
+	}, nil
+}
+
+// outcome returns the updates recording an attempt at a claimed email that ended in err:
+// sent, failed after MaxDeliveryAttempts, or pending again after retryDelay
+func outcome(email model.OutboxEmail, err error, now time.Time) []firestore.Update {
+	switch {
+	case err == nil:
+		return finished(OutboxSent, now)
+	case email.Attempts >= MaxDeliveryAttempts:
+		return append(finished(OutboxFailed, now), firestore.Update{Path: "LastError", Value: err.Error()})
+	default:
+		return []firestore.Update{
+			{Path: "Status", Value: OutboxPending},
+			{Path: "NextAttemptAt", Value: now.Add(retryDelay(email.Attempts))},
+			{Path: "LastError", Value: err.Error()},
+		}
+	}
+}
+
+// finished marks an email as done and drops its body, which may hold a code or link
+func finished(status string, now time.Time) []firestore.Update {
+	return []firestore.Update{
+		{Path: "Status", Value: status},
+		{Path: "FinishedAt", Value: now},
+		{Path: "NextAttemptAt", Value: firestore.Delete},
+		{Path: "Text", Value: firestore.Delete},
+		{Path: "HTML", Value: firestore.Delete},
+	}
+}
+
+// retryDelay doubles the wait after each failed attempt, up to maxRetryDelay
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// DeleteFinishedEmails removes sent and failed emails older than the retention period
+func DeleteFinishedEmails() {
+	iter := outbox().Where("FinishedAt", "<=", time.Now().Add(-outboxRetention)).Documents(db.Ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Printf("Error listing finished emails: %v", err)
+			return
+		}
+		if _, err := doc.Ref.Delete(db.Ctx); err != nil {
+			log.Printf("Failed to delete email %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package email
+
+import (
+	"backend/model"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// updated returns the updates as a map from path to value
+func updated(updates []firestore.Update) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, u := range updates {
+		values[u.Path] = u.Value
+	}
+	return values
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestClaim(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		next time.Time
+		due  bool
+	}{
+		{name: "due", next: now.Add(-time.Second), due: true},
+		{name: "due now", next: now, due: true},
+		{name: "lease run out", next: now.Add(-sendingLease), due: true},
+		{name: "leased to another worker", next: now.Add(sendingLease), due: false},
+		{name: "waiting for retry", next: now.Add(time.Minute), due: false},
+		{name: "finished", next: time.Time{}, due: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := model.OutboxEmail{Status: OutboxPending, Attempts: 2, NextAttemptAt: tt.next}
+			updates, err := claim(&email, now)
+			if !tt.due {
+				if err != errNotDue || updates != nil || email.Attempts != 2 {
+					t.Fatalf("claim() = %v, %v with %d attempts, want errNotDue", updates, err, email.Attempts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := updated(updates)
+			if values["Status"] != OutboxSending || values["Attempts"] != 3 || email.Attempts != 3 {
+				t.Errorf("claim() = %v, want sending with 3 attempts", values)
+			}
+			if values["NextAttemptAt"] != now.Add(sendingLease) {
+				t.Errorf("claim() leases until %v, want %v", values["NextAttemptAt"], now.Add(sendingLease))
+			}
+		})
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	failure := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		attempts  int
+		err       error
+		status    string
+		next      interface{}
+		lastError interface{}
+	}{
+		{name: "sent", attempts: 1, status: OutboxSent, next: firestore.Delete},
+		{name: "sent on the last attempt", attempts: MaxDeliveryAttempts, status: OutboxSent, next: firestore.Delete},
+		{name: "first failure", attempts: 1, err: failure, status: OutboxPending, next: now.Add(30 * time.Second), lastError: failure.Error()},
+		{name: "later failure", attempts: 3, err: failure, status: OutboxPending, next: now.Add(2 * time.Minute), lastError: failure.Error()},
+		{name: "last attempt failed", attempts: MaxDeliveryAttempts, err: failure, status: OutboxFailed, next: firestore.Delete, lastError: failure.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := updated(outcome(model.OutboxEmail{Attempts: tt.attempts}, tt.err, now))
+			if values["Status"] != tt.status {
+				t.Errorf("Status = %v, want %v", values["Status"], tt.status)
+			}
+			if values["NextAttemptAt"] != tt.next {
+				t.Errorf("NextAttemptAt = %v, want %v", values["NextAttemptAt"], tt.next)
+			}
+			if values["LastError"] != tt.lastError {
+				t.Errorf("LastError = %v, want %v", values["LastError"], tt.lastError)
+			}
+
+			// Finished emails record when and lose their body; pending ones keep it
+			_, hasFinishedAt := values["FinishedAt"]
+			finished := tt.status != OutboxPending
+			if hasFinishedAt != finished {
+				t.Errorf("FinishedAt set = %v, want %v", hasFinishedAt, finished)
+			}
+			if finished && (values["Text"] != firestore.Delete || values["HTML"] != firestore.Delete) {
+				t.Errorf("finished email keeps its body: %v", values)
+			}
+			if !finished && (values["Text"] != nil || values["HTML"] != nil) {
+				t.Errorf("pending email loses its body: %v", values)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"backend/apierror"
+	"backend/function"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// previewData fills in each email for previews
+var previewData = map[string]map[string]interface{}{
+	"verify_email":      {"Code": "123456", "Link": function.AppURL("/links/verify-email?token=preview"), "Minutes": 5},
+	"password_reset":    {"Code": "123456", "Link": function.AppURL("/links/password-reset?token=preview"), "Minutes": 5},
+	"login_link":        {"Link": function.AppURL("/links/login?token=preview"), "Minutes": 15},
+	"email_change_code": {"Code": "123456", "Minutes": 10},
+	"reauth_code":       {"Code": "123456", "Minutes": 10},
+	"email_changed":     {"NewEmail": "new.address@example.com"},
+	"journal_reminder":  {"Prompt": "What are three things you are grateful for today?", "Link": function.AppURL("/journal")},
+}
+
+// PreviewListHandler lists the emails PreviewHandler can show
+func PreviewListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": Templates(),
+		"languages": Languages,
+	})
+}
+
+// PreviewHandler shows an email filled in with sample data, in the language of the lang
+// parameter. format=text shows the plain-text part instead of the HTML.
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(Templates(), name) {
+		apierror.Write(w, http.StatusNotFound, apierror.NotFound, "No email template "+name)
+		return
+	}
+	msg, err := Render(name, r.URL.Query().Get("lang"), previewData[name])
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n\n%s", msg.Subject, msg.Text)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, msg.HTML)
+}
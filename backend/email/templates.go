@@ -0,0 +1,183 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Emails are built from the templates in templates/. Each email has a name.html and a
+// name.txt file defining "content", which the shared layout.html and layout.txt wrap.
+// Neither holds any words: they call {{t "key"}}, which looks up "name.key" (or, for
+// shared strings, "key") in locales/<language>.json. Strings are templates too and can
+// use the email's data, e.g. "It expires in {{.Minutes}} minutes."
+//
+//go:embed templates locales
+var files embed.FS
+
+// DefaultLanguage is used for users without a language and for strings a locale lacks
+const DefaultLanguage = "en"
+
+// Languages lists the languages emails are written in
+var Languages = []string{"en", "nb"}
+
+// Message is a rendered email
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+var (
+	loadOnce      sync.Once
+	locales       map[string]map[string]string
+	htmlTemplates map[string]*htmltemplate.Template
+	textTemplates map[string]*texttemplate.Template
+)
+
+// placeholder stands in for the t function until a language is chosen in Render
+var placeholder = map[string]interface{}{"t": func(string) (string, error) { return "", nil }}
+
+// load parses the embedded templates and strings. They ship with the binary, so an
+// error is a bug and panics.
+func load() {
+	locales = make(map[string]map[string]string)
+	for _, lang := range Languages {
+		raw, err := files.ReadFile("locales/" + lang + ".json")
+		if err != nil {
+			panic(err)
+		}
+		var strs map[string]string
+		if err := json.Unmarshal(raw, &strs); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", lang, err))
+		}
+		locales[lang] = strs
+	}
+
+	htmlTemplates = make(map[string]*htmltemplate.Template)
+	textTemplates = make(map[string]*texttemplate.Template)
+	for _, name := range Templates() {
+		htmlTemplates[name] = htmltemplate.Must(htmltemplate.New("layout.html").Funcs(placeholder).
+			ParseFS(files, "templates/layout.html", "templates/"+name+".html"))
+		textTemplates[name] = texttemplate.Must(texttemplate.New("layout.txt").Funcs(placeholder).
+			ParseFS(files, "templates/layout.txt", "templates/"+name+".txt"))
+	}
+}
+
+// Templates returns the names of the emails there are templates for
+func Templates() []string {
+	entries, err := files.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".html")
+		if path.Ext(entry.Name()) == ".html" && name != "layout" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Language picks the email language for a stored preference or an Accept-Language
+// value, falling back to DefaultLanguage. Norwegian variants (no, nn) map to Bokmål (nb).
+func Language(preference string) string {
+	loadOnce.Do(load)
+	// Take the first tag of an Accept-Language list, e.g. "nb-NO,nb;q=0.9,en;q=0.8"
+	lang := strings.ToLower(strings.TrimSpace(strings.Split(preference, ",")[0]))
+	lang = strings.Split(strings.Split(lang, ";")[0], "-")[0]
+	if lang == "no" || lang == "nn" {
+		lang = "nb"
+	}
+	if _, ok := locales[lang]; !ok {
+		return DefaultLanguage
+	}
+	return lang
+}
+
+// UserLanguage returns the email language of the user document
+func UserLanguage(doc *firestore.DocumentSnapshot) string {
+	lang, _ := doc.Data()["Language"].(string)
+	return Language(lang)
+}
+
+// Render builds the email called name in the given language
+func Render(name, lang string, data map[string]interface{}) (Message, error) {
+	loadOnce.Do(load)
+	htmlTemplate, ok := htmlTemplates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("no email template %q", name)
+	}
+	lang = Language(lang)
+
+	// The templates see the caller's data plus the language, for <html lang>
+	values := map[string]interface{}{"Lang": lang}
+	for key, value := range data {
+		values[key] = value
+	}
+	t := func(key string) (string, error) {
+		return localize(name, lang, key, values)
+	}
+
+	subject, err := t("subject")
+	if err != nil {
+		return Message{}, err
+	}
+	var text, html bytes.Buffer
+	textTemplate, err := textTemplates[name].Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	if err := textTemplate.Funcs(map[string]interface{}{"t": t}).Execute(&text, values); err != nil {
+		return Message{}, err
+	}
+	htmlTemplate, err = htmlTemplate.Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplate.Funcs(map[string]interface{}{"t": t}).Execute(&html, values); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+// localize returns the string for key in the email called name, filled in with data.
+// Strings missing from a locale come from DefaultLanguage.
+func localize(name, lang, key string, data map[string]interface{}) (string, error) {
+	var source string
+	found := false
+	for _, l := range []string{lang, DefaultLanguage} {
+		for _, k := range []string{name + "." + key, key} {
+			if source, found = locales[l][k]; found {
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("email %s: no string %q", name, key)
+	}
+
+	tmpl, err := texttemplate.New(key).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("email %s: string %q: %v", name, key, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("email %s: string %q: %v", name, key, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,128 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		preference string
+		want       string
+	}{
+		{"", "en"},
+		{"en", "en"},
+		{"nb", "nb"},
+		{"NB", "nb"},
+		{"nb-NO", "nb"},
+		{"no", "nb"},
+		{"nn-NO", "nb"},
+		{"nb-NO,nb;q=0.9,en;q=0.8", "nb"},
+		{"en-GB,nb;q=0.8", "en"},
+		{"de", "en"},
+		{"de-DE,nb;q=0.9", "en"},
+	}
+	for _, tt := range tests {
+		if got := Language(tt.preference); got != tt.want {
+			t.Errorf("Language(%q) = %q, want %q", tt.preference, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		lang    string
+		subject string
+		html    string
+	}{
+		{name: "english", lang: "en", subject: "Your email address was changed", html: `<html lang="en">`},
+		{name: "norwegian", lang: "nb-NO", subject: "E-postadressen din ble endret", html: `<html lang="nb">`},
+		{name: "unknown language falls back to english", lang: "de", subject: "Your email address was changed", html: `<html lang="en">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Render("email_changed", tt.lang, map[string]interface{}{"NewEmail": "new@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.subject)
+			}
+			if !strings.Contains(msg.HTML, tt.html) || !strings.Contains(msg.HTML, "new@example.com") {
+				t.Errorf("HTML lacks %q or the new address:\n%s", tt.html, msg.HTML)
+			}
+			if !strings.Contains(msg.Text, "new@example.com") {
+				t.Errorf("Text lacks the new address:\n%s", msg.Text)
+			}
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := Render("journal_reminder", "en", map[string]interface{}{
+		"Prompt": "<script>alert(1)</script>",
+		"Link":   "https://example.com/journal",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") || !strings.Contains(msg.HTML, "&lt;script&gt;") {
+		t.Errorf("HTML doesn't escape the prompt:\n%s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "<script>alert(1)</script>") {
+		t.Errorf("Text should keep the prompt as is:\n%s", msg.Text)
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("no_such_email", "en", nil); err == nil {
+		t.Error("Render() of an unknown template succeeded")
+	}
+}
+
+func TestRenderMissingData(t *testing.T) {
+	if _, err := Render("email_changed", "en", nil); err == nil {
+		t.Error("Render() without NewEmail succeeded")
+	}
+}
+
+func TestLocalizeFallback(t *testing.T) {
+	Language("") // loads the locales
+	saved := locales["nb"]
+	defer func() { locales["nb"] = saved }()
+	locales["nb"] = map[string]string{"footer": "Bunntekst"}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"footer", "Bunntekst"},
+		{"subject", "Your email address was changed"},
+	}
+	for _, tt := range tests {
+		got, err := localize("email_changed", "nb", tt.key, nil)
+		if err != nil || got != tt.want {
+			t.Errorf("localize(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+	if _, err := localize("email_changed", "nb", "no_such_key", nil); err == nil {
+		t.Error("localize() of a missing key succeeded")
+	}
+}
+
+// Every email renders with its preview data in every language
+func TestTemplates(t *testing.T) {
+	for _, name := range Templates() {
+		for _, lang := range Languages {
+			msg, err := Render(name, lang, previewData[name])
+			if err != nil {
+				t.Errorf("Render(%q, %q): %v", name, lang, err)
+				continue
+			}
+			if msg.Subject == "" || msg.Text == "" || msg.HTML == "" {
+				t.Errorf("Render(%q, %q) has an empty part", name, lang)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package email
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/identity"
+	"backend/magiclink"
+	"backend/model"
+	"backend/validation"
+	"net/http"
+)
+
+// VerifyEmailLink verifies an address with the link from the verification email instead
+// of the code, and answers like VerifyEmail
+func VerifyEmailLink(w http.ResponseWriter, r *http.Request) {
+	var requestData model.LinkRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
+		return
+	}
+
+	// Check the link; a valid one is used up
+	userID, ok := magiclink.Check(w, requestData.Token, magiclink.VerifyEmail)
+	if !ok {
+		return
+	}
+
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	if isVerified, _ := doc.Data()["IsVerified"].(bool); isVerified {
+		apierror.Write(w, http.StatusBadRequest, apierror.AlreadyVerified, "User already verified")
+		return
+	}
+
+	markVerified(w, doc.Ref)
+}
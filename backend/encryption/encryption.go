@@ -0,0 +1,335 @@
+package encryption
+
+import (
+	"backend/db"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prefix marking a value produced by Encrypt; values without it are legacy plaintext
+const ciphertextPrefix = "enc:v1:"
+
+// Name of the per-user key document in the user's "keys" subcollection
+const journalKeyDoc = "journal"
+
+// masterKey is a key-encryption key loaded from the environment
+type masterKey struct {
+	ID  string
+	Key []byte
+}
+
+// dataKeyRecord is how a wrapped per-user data key is stored in Firestore
+type dataKeyRecord struct {
+	WrappedKey  string
+	MasterKeyID string
+	CreatedAt   time.Time
+	RotatedAt   time.Time
+}
+
+var (
+	loadOnce   sync.Once
+	masterKeys []masterKey // masterKeys[0] is the current key
+	loadErr    error
+
+	cacheMutex sync.Mutex
+	keyCache   = make(map[string][]byte)
+)
+
+// loadMasterKeys reads JOURNAL_MASTER_KEYS as a comma-separated list of "id:base64key" pairs.
+// The first entry wraps new data keys; the rest are only used to unwrap keys during rotation.
+func loadMasterKeys() {
+	var raw string
+
+	// Try to read the keys from Docker secret first
+	secretBytes, err := os.ReadFile("/run/secrets/JOURNAL_MASTER_KEYS")
+	if err == nil {
+		raw = strings.TrimSpace(string(secretBytes))
+	} else if os.IsNotExist(err) {
+		raw = os.Getenv("JOURNAL_MASTER_KEYS")
+	} else {
+		loadErr = fmt.Errorf("failed to read JOURNAL_MASTER_KEYS: %v", err)
+		return
+	}
+
+	if raw == "" {
+		log.Println("JOURNAL_MASTER_KEYS is not set; journal entries will be stored unencrypted")
+		return
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			loadErr = fmt.Errorf("invalid JOURNAL_MASTER_KEYS entry, expected id:base64key")
+			return
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(key) != 32 {
+			loadErr = fmt.Errorf("master key %s must be 32 bytes encoded as base64", parts[0])
+			return
+		}
+		masterKeys = append(masterKeys, masterKey{ID: parts[0], Key: key})
+	}
+}
+
+// Enabled reports whether a master key is configured
+func Enabled() bool {
+	loadOnce.Do(loadMasterKeys)
+	return loadErr == nil && len(masterKeys) > 0
+}
+
+// findMasterKey returns the master key with the given ID
+func findMasterKey(id string) ([]byte, error) {
+	for _, mk := range masterKeys {
+		if mk.ID == id {
+			return mk.Key, nil
+		}
+	}
+	return nil, fmt.Errorf("master key %s is not configured", id)
+}
+
+// seal encrypts plaintext with AES-256-GCM and returns nonce|ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open reverses seal
+func open(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// wrap encrypts a data key with the current master key
+func wrap(dataKey []byte) (dataKeyRecord, error) {
+	current := masterKeys[0]
+	wrapped, err := seal(current.Key, dataKey)
+	if err != nil {
+		return dataKeyRecord{}, err
+	}
+	return dataKeyRecord{
+		WrappedKey:  base64.StdEncoding.EncodeToString(wrapped),
+		MasterKeyID: current.ID,
+	}, nil
+}
+
+// unwrap decrypts a stored data key with the master key it was wrapped under
+func unwrap(record dataKeyRecord) ([]byte, error) {
+	mk, err := findMasterKey(record.MasterKeyID)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(record.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(mk, wrapped)
+}
+
+// UserKey returns the user's journal data key, creating it on first use and
+// rewrapping it under the current master key if it was wrapped by an older one.
+// It returns nil when encryption is not configured.
+func UserKey(userID string) ([]byte, error) {
+	if !Enabled() {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return nil, nil
+	}
+
+	cacheMutex.Lock()
+	cached, ok := keyCache[userID]
+	cacheMutex.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	docRef := db.Client.Collection("users").Doc(userID).Collection("keys").Doc(journalKeyDoc)
+	doc, err := docRef.Get(db.Ctx)
+	if status.Code(err) == codes.NotFound {
+		dataKey := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+			return nil, err
+		}
+		record, err := wrap(dataKey)
+		if err != nil {
+			return nil, err
+		}
+		record.CreatedAt = time.Now()
+
+		// Create fails if a concurrent request already stored a key; use theirs instead
+		if _, err := docRef.Create(db.Ctx, record); err != nil {
+			if status.Code(err) != codes.AlreadyExists {
+				return nil, err
+			}
+			return UserKey(userID)
+		}
+		cacheKey(userID, dataKey)
+		return dataKey, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record dataKeyRecord
+	if err := doc.DataTo(&record); err != nil {
+		return nil, err
+	}
+	dataKey, err := unwrap(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key for %s: %v", userID, err)
+	}
+
+	if record.MasterKeyID != masterKeys[0].ID {
+		if err := rewrap(docRef.Path, dataKey, record.CreatedAt); err != nil {
+			log.Printf("Failed to rewrap data key for %s: %v", userID, err)
+		}
+	}
+
+	cacheKey(userID, dataKey)
+	return dataKey, nil
+}
+
+// rewrap stores dataKey wrapped under the current master key
+func rewrap(path string, dataKey []byte, createdAt time.Time) error {
+	record, err := wrap(dataKey)
+	if err != nil {
+		return err
+	}
+	record.CreatedAt = createdAt
+	record.RotatedAt = time.Now()
+	_, err = db.Client.Doc(path).Set(db.Ctx, record)
+	return err
+}
+
+func cacheKey(userID string, dataKey []byte) {
+	cacheMutex.Lock()
+	keyCache[userID] = dataKey
+	cacheMutex.Unlock()
+}
+
+// RewrapDataKeys rewraps every stored data key that is not yet under the current master key.
+// Run it after putting a new key first in JOURNAL_MASTER_KEYS; once it reports no failures
+// the old master key can be removed from the list.
+func RewrapDataKeys() {
+	if !Enabled() {
+		return
+	}
+
+	docs, err := db.Client.CollectionGroup("keys").Where("MasterKeyID", "!=", masterKeys[0].ID).Documents(db.Ctx).GetAll()
+	if err != nil {
+		log.Printf("Error listing data keys for rotation: %v", err)
+		return
+	}
+
+	var rotated, failed int
+	for _, doc := range docs {
+		var record dataKeyRecord
+		if err := doc.DataTo(&record); err != nil {
+			failed++
+			continue
+		}
+		dataKey, err := unwrap(record)
+		if err != nil {
+			log.Printf("Failed to unwrap data key %s: %v", doc.Ref.Path, err)
+			failed++
+			continue
+		}
+		if err := rewrap(doc.Ref.Path, dataKey, record.CreatedAt); err != nil {
+			log.Printf("Failed to rewrap data key %s: %v", doc.Ref.Path, err)
+			failed++
+			continue
+		}
+		rotated++
+	}
+
+	log.Printf("Data key rotation complete. Rewrapped %d keys, %d failures.", rotated, failed)
+}
+
+// Encrypt encrypts plaintext with a data key. A nil key returns the plaintext unchanged.
+func Encrypt(dataKey []byte, plaintext string) (string, error) {
+	if dataKey == nil {
+		return plaintext, nil
+	}
+	sealed, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return ciphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Values that were never encrypted are returned as-is.
+func Decrypt(dataKey []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if dataKey == nil {
+		return "", errors.New("value is encrypted but no data key is available")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, ciphertextPrefix))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
+
+// BlindIndex maps search tokens to keyed hashes so they can be stored and queried
+// without revealing the words themselves. A nil key returns the tokens unchanged.
+func BlindIndex(dataKey []byte, tokens []string) []string {
+	if dataKey == nil {
+		return tokens
+	}
+	hashed := make([]string, len(tokens))
+	for i, token := range tokens {
+		mac := hmac.New(sha256.New, dataKey)
+		mac.Write([]byte(token))
+		hashed[i] = hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+	return hashed
+}
@@ -3,8 +3,10 @@
 package event
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/model"
+	"backend/validation"
 	"encoding/json"
 	"io"
 	"log"
@@ -29,47 +31,30 @@ func contains(slice []string, item string) bool {
 // CreateEventHandler handles creating a new event
 func CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 	var event model.Event
-	err := json.NewDecoder(r.Body).Decode(&event)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate EventTypeID
-	event.EventTypeID = strings.ToLower(event.EventTypeID)
-	if event.EventTypeID != "public" && event.EventTypeID != "private" {
-		http.Error(w, "Invalid event type", http.StatusBadRequest)
+	if !validation.DecodeJSON(w, r, &event) {
 		return
 	}
 
-	// Parse and format the date
-	eventDate, err := time.Parse("2006-01-02", event.Date)
-	if err != nil {
-		http.Error(w, "Invalid date format. Please use YYYY-MM-DD.", http.StatusBadRequest)
+	// Ensure the event is owned by the logged-in user
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
-	event.Date = eventDate.Format("2006-01-02")
-
-	// Ensure the event includes the user's email
-	userEmail, ok := r.Context().Value("userEmail").(string)
-	if !ok || userEmail == "" {
-		http.Error(w, "User email not found in context", http.StatusUnauthorized)
-		return
-	}
-	event.Email = userEmail
+	event.UserID = userID
 
 	// Add the event to Firestore under the user's events subcollection
-	userDocRef := db.Client.Collection("users").Doc(event.Email).Collection("events")
+	userDocRef := db.Client.Collection("users").Doc(event.UserID).Collection("events")
 	docRef, _, err := userDocRef.Add(db.Ctx, event)
 	if err != nil {
-		http.Error(w, "Failed to create event", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create event")
 		return
 	}
 
 	event.EventID = docRef.ID
 	_, err = docRef.Set(db.Ctx, event)
 	if err != nil {
-		http.Error(w, "Failed to update event with EventID", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update event with EventID")
 		return
 	}
 
@@ -84,35 +69,35 @@ func CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 func GetEventHandler(w http.ResponseWriter, r *http.Request) {
 	eventID := r.URL.Query().Get("eventID")
 	if eventID == "" {
-		http.Error(w, "Missing eventID parameter", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing eventID parameter")
 		return
 	}
 
-	// Retrieve the user's email from the context
-	userEmail, ok := r.Context().Value("userEmail").(string)
-	if !ok || userEmail == "" {
-		http.Error(w, "User email not found in context", http.StatusUnauthorized)
+	// Retrieve the user's ID from the context
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
 	// Retrieve the event from the user's subcollection
-	docRef := db.Client.Collection("users").Doc(userEmail).Collection("events").Doc(eventID)
+	docRef := db.Client.Collection("users").Doc(userID).Collection("events").Doc(eventID)
 	doc, err := docRef.Get(db.Ctx)
 	if err != nil || !doc.Exists() {
-		http.Error(w, "Event not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.EventNotFound, "Event not found")
 		return
 	}
 
 	var event model.Event
 	err = doc.DataTo(&event)
 	if err != nil {
-		http.Error(w, "Error parsing event data", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error parsing event data")
 		return
 	}
 
 	// Ensure that the event belongs to the user
-	if event.Email != userEmail {
-		http.Error(w, "Unauthorized to access this event", http.StatusUnauthorized)
+	if event.UserID != userID {
+		apierror.Write(w, http.StatusUnauthorized, apierror.EventAccessDenied, "Unauthorized to access this event")
 		return
 	}
 
@@ -124,49 +109,48 @@ func GetEventHandler(w http.ResponseWriter, r *http.Request) {
 func UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
 	eventID := r.URL.Query().Get("eventID")
 	if eventID == "" {
-		http.Error(w, "Missing eventID parameter", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing eventID parameter")
 		return
 	}
 
 	var event model.Event
-	err := json.NewDecoder(r.Body).Decode(&event)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !validation.DecodeJSON(w, r, &event) {
 		return
 	}
 
-	// Retrieve the user's email from the context
-	userEmail, ok := r.Context().Value("userEmail").(string)
-	if !ok || userEmail == "" {
-		http.Error(w, "User email not found in context", http.StatusUnauthorized)
+	// Retrieve the user's ID from the context
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
 	// Retrieve the existing event to verify ownership
-	docRef := db.Client.Collection("users").Doc(userEmail).Collection("events").Doc(eventID)
+	docRef := db.Client.Collection("users").Doc(userID).Collection("events").Doc(eventID)
 	doc, err := docRef.Get(db.Ctx)
 	if err != nil || !doc.Exists() {
-		http.Error(w, "Event not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.EventNotFound, "Event not found")
 		return
 	}
 
 	var existingEvent model.Event
 	err = doc.DataTo(&existingEvent)
 	if err != nil {
-		http.Error(w, "Error parsing event data", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error parsing event data")
 		return
 	}
 
-	if existingEvent.Email != userEmail {
-		http.Error(w, "Unauthorized to update this event", http.StatusUnauthorized)
+	if existingEvent.UserID != userID {
+		apierror.Write(w, http.StatusUnauthorized, apierror.EventAccessDenied, "Unauthorized to update this event")
 		return
 	}
 
 	// Update the event
 	event.EventID = eventID // Ensure EventID is set
+	event.UserID = userID
 	_, err = docRef.Set(db.Ctx, event)
 	if err != nil {
-		http.Error(w, "Failed to update event", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update event")
 		return
 	}
 
@@ -180,41 +164,41 @@ func UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
 func DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
 	eventID := r.URL.Query().Get("eventID")
 	if eventID == "" {
-		http.Error(w, "Missing eventID parameter", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing eventID parameter")
 		return
 	}
 
-	// Retrieve the user's email from the context
-	userEmail, ok := r.Context().Value("userEmail").(string)
-	if !ok || userEmail == "" {
-		http.Error(w, "User email not found in context", http.StatusUnauthorized)
+	// Retrieve the user's ID from the context
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
 	// Retrieve the existing event to verify ownership
-	docRef := db.Client.Collection("users").Doc(userEmail).Collection("events").Doc(eventID)
+	docRef := db.Client.Collection("users").Doc(userID).Collection("events").Doc(eventID)
 	doc, err := docRef.Get(db.Ctx)
 	if err != nil || !doc.Exists() {
-		http.Error(w, "Event not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.EventNotFound, "Event not found")
 		return
 	}
 
 	var existingEvent model.Event
 	err = doc.DataTo(&existingEvent)
 	if err != nil {
-		http.Error(w, "Error parsing event data", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error parsing event data")
 		return
 	}
 
-	if existingEvent.Email != userEmail {
-		http.Error(w, "Unauthorized to delete this event", http.StatusUnauthorized)
+	if existingEvent.UserID != userID {
+		apierror.Write(w, http.StatusUnauthorized, apierror.EventAccessDenied, "Unauthorized to delete this event")
 		return
 	}
 
 	// Proceed to delete the event
 	_, err = docRef.Delete(db.Ctx)
 	if err != nil {
-		http.Error(w, "Failed to delete event", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to delete event")
 		return
 	}
 
@@ -226,51 +210,57 @@ func DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetAllEventsHandler fetches all events for the authenticated user, including public events from mutual friends
 func GetAllEventsHandler(w http.ResponseWriter, r *http.Request) {
-	// Retrieve the user's email from the query parameter
-	userEmail := r.URL.Query().Get("email")
-	if userEmail == "" {
-		http.Error(w, "Missing email parameter", http.StatusBadRequest)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
-	log.Printf("GetAllEventsHandler called by user: %s", userEmail)
+	log.Printf("GetAllEventsHandler called by user: %s", userID)
 
 	// Get user's accepted friends
 	friendsDocs, err := db.Client.Collection("friends").
-		Where("Email", "==", userEmail).
+		Where("UserID", "==", userID).
 		Where("Status", "==", "accepted").
 		Documents(db.Ctx).GetAll()
 	if err != nil {
 		log.Printf("Error fetching friends: %v", err)
-		http.Error(w, "Failed to fetch friends", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch friends")
 		return
 	}
 
 	log.Printf("Fetched %d friends", len(friendsDocs))
 
-	var mutualFriendEmails []string
+	var mutualFriendIDs []string
 	for _, doc := range friendsDocs {
-		friendEmail := doc.Data()["FriendEmail"].(string)
+		friendID := doc.Data()["FriendID"].(string)
 
 		// Check if the friend also has the current user as a friend (mutual friendship)
 		mutualDocs, err := db.Client.Collection("friends").
-			Where("Email", "==", friendEmail).
-			Where("FriendEmail", "==", userEmail).
+			Where("UserID", "==", friendID).
+			Where("FriendID", "==", userID).
 			Where("Status", "==", "accepted").
 			Documents(db.Ctx).GetAll()
 
 		// If mutual friend, add to list of friends
 		if err == nil && len(mutualDocs) > 0 {
-			mutualFriendEmails = append(mutualFriendEmails, friendEmail)
+			mutualFriendIDs = append(mutualFriendIDs, friendID)
 		}
 	}
 
+	// Events are stored by owner ID; responses carry the owner's current email
+	emails, err := emailsByUserID(append([]string{userID}, mutualFriendIDs...))
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch event owners")
+		return
+	}
+
 	var events []model.Event
 
 	// Query the user's own events
-	userEventsDocs, err := db.Client.Collection("users").Doc(userEmail).Collection("events").Documents(db.Ctx).GetAll()
+	userEventsDocs, err := db.Client.Collection("users").Doc(userID).Collection("events").Documents(db.Ctx).GetAll()
 	if err != nil {
-		http.Error(w, "Failed to fetch user's events", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch user's events")
 		return
 	}
 
@@ -278,32 +268,33 @@ func GetAllEventsHandler(w http.ResponseWriter, r *http.Request) {
 		var event model.Event
 		err := doc.DataTo(&event)
 		if err != nil {
-			http.Error(w, "Error parsing event data", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error parsing event data")
 			return
 		}
 
 		event.EventID = doc.Ref.ID
+		event.Email = emails[event.UserID]
 
 		events = append(events, event)
 	}
 
 	// Now, query public events from mutual friends
-	if len(mutualFriendEmails) > 0 {
+	if len(mutualFriendIDs) > 0 {
 		batchSize := 10
-		for i := 0; i < len(mutualFriendEmails); i += batchSize {
+		for i := 0; i < len(mutualFriendIDs); i += batchSize {
 			end := i + batchSize
-			if end > len(mutualFriendEmails) {
-				end = len(mutualFriendEmails)
+			if end > len(mutualFriendIDs) {
+				end = len(mutualFriendIDs)
 			}
-			batchEmails := mutualFriendEmails[i:end]
+			batchIDs := mutualFriendIDs[i:end]
 
 			// Perform collection group query
 			query := db.Client.CollectionGroup("events").
-				Where("Email", "in", batchEmails).
+				Where("UserID", "in", batchIDs).
 				Where("EventTypeID", "==", "public")
 			mutualEventsDocs, err := query.Documents(db.Ctx).GetAll()
 			if err != nil {
-				http.Error(w, "Failed to fetch mutual friends' events", http.StatusInternalServerError)
+				apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch mutual friends' events")
 				return
 			}
 
@@ -311,11 +302,12 @@ func GetAllEventsHandler(w http.ResponseWriter, r *http.Request) {
 				var event model.Event
 				err := doc.DataTo(&event)
 				if err != nil {
-					http.Error(w, "Error parsing event data", http.StatusInternalServerError)
+					apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error parsing event data")
 					return
 				}
 
 				event.EventID = doc.Ref.ID
+				event.Email = emails[event.UserID]
 
 				events = append(events, event)
 			}
@@ -325,19 +317,19 @@ func GetAllEventsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(events)
 	if err != nil {
-		http.Error(w, "Failed to encode events", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encode events")
 		return
 	}
 }
 
 func NTNUTimetableImportHandler(w http.ResponseWriter, r *http.Request) {
-	userEmail := r.Context().Value("userEmail").(string)
-	eventsCollection := db.Client.Collection("users").Doc(userEmail).Collection("events")
+	userID := r.Context().Value("userID").(string)
+	eventsCollection := db.Client.Collection("users").Doc(userID).Collection("events")
 
 	// Check if the request is a file upload
 	if r.Method == http.MethodPost {
 		if err := r.ParseMultipartForm(10 << 20); err != nil { // Limit file size to 10 MB
-			http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidBody, "Failed to parse multipart form")
 			return
 		}
 
@@ -348,10 +340,10 @@ func NTNUTimetableImportHandler(w http.ResponseWriter, r *http.Request) {
 			defer file.Close()
 			cal, err := ics.ParseCalendar(file)
 			if err != nil {
-				http.Error(w, "Failed to parse ICS file", http.StatusInternalServerError)
+				apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse ICS file")
 				return
 			}
-			importEvents(cal, eventsCollection, userEmail)
+			importEvents(cal, eventsCollection, userID)
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]string{"message": "ICS file imported successfully"})
 			return
@@ -360,41 +352,61 @@ func NTNUTimetableImportHandler(w http.ResponseWriter, r *http.Request) {
 		// Check for URL parameter
 		url := r.FormValue("url")
 		if url == "" {
-			http.Error(w, "Missing url parameter or file", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing url parameter or file")
 			return
 		}
 
 		// Fetch and parse the NTNU timetable from the URL
 		resp, err := http.Get(url)
 		if err != nil {
-			http.Error(w, "Failed to fetch NTNU timetable", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Failed to fetch NTNU timetable")
 			return
 		}
 		defer resp.Body.Close()
 
 		data, err := io.ReadAll(resp.Body)
 		if err != nil {
-			http.Error(w, "Failed to read NTNU timetable", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Failed to read NTNU timetable")
 			return
 		}
 
 		cal, err := ics.ParseCalendar(strings.NewReader(string(data)))
 		if err != nil {
-			http.Error(w, "Failed to parse NTNU timetable", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Failed to parse NTNU timetable")
 			return
 		}
 
-		importEvents(cal, eventsCollection, userEmail)
+		importEvents(cal, eventsCollection, userID)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "NTNU timetable imported successfully"})
 		return
 	}
 
-	http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	apierror.Write(w, http.StatusMethodNotAllowed, apierror.MethodNotAllowed, "Invalid request method")
+}
+
+// emailsByUserID reads the current email address of each user
+func emailsByUserID(userIDs []string) (map[string]string, error) {
+	refs := make([]*firestore.DocumentRef, len(userIDs))
+	for i, userID := range userIDs {
+		refs[i] = db.Client.Collection("users").Doc(userID)
+	}
+	docs, err := db.Client.GetAll(db.Ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make(map[string]string)
+	for _, doc := range docs {
+		if doc.Exists() {
+			emails[doc.Ref.ID], _ = doc.Data()["Email"].(string)
+		}
+	}
+	return emails, nil
 }
 
 // Helper function to import events into Firestore
-func importEvents(cal *ics.Calendar, eventsCollection *firestore.CollectionRef, userEmail string) {
+func importEvents(cal *ics.Calendar, eventsCollection *firestore.CollectionRef, userID string) {
 	for _, event := range cal.Events() {
 		startTime, err := time.Parse("20060102T150405Z", event.GetProperty("DTSTART").Value)
 		if err != nil {
@@ -416,7 +428,7 @@ func importEvents(cal *ics.Calendar, eventsCollection *firestore.CollectionRef,
 			StartTime:     startTime.Format(time.RFC3339),
 			EndTime:       endTime.Format(time.RFC3339),
 			Date:          startTime.Format("2006-01-02"),
-			Email:         userEmail,
+			UserID:        userID,
 		}
 
 		// Add the event to Firestore
@@ -1,8 +1,10 @@
 package friend
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/model"
+	"backend/validation"
 	"cloud.google.com/go/firestore"
 	"encoding/json"
 	"net/http"
@@ -10,60 +12,56 @@ import (
 
 // SendFriendRequestByUsername allows users to send friend requests using a username
 func SendFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Username string `json:"username"` // Target user's username (friend to add)
-	}
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var requestBody model.UsernameRequest // Target user's username (friend to add)
+	if !validation.DecodeJSON(w, r, &requestBody) {
 		return
 	}
 
-	// Retrieve the sender email from context (JWT claims)
-	requesterEmail := r.Context().Value("userEmail").(string)
+	// Retrieve the sender ID from context (JWT claims)
+	requesterID := r.Context().Value("userID").(string)
 
-	// Retrieve the email of the user by username
+	// Retrieve the ID of the user by username
 	doc, err := db.Client.Collection("users").Where("Username", "==", requestBody.Username).Limit(1).Documents(db.Ctx).Next()
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "User not found")
 		return
 	}
-	friendEmail := doc.Data()["Email"].(string)
+	friendID := doc.Ref.ID
 
 	// Prevent sending a friend request to self
-	if requesterEmail == friendEmail {
-		http.Error(w, "You cannot send a friend request to yourself", http.StatusBadRequest)
+	if requesterID == friendID {
+		apierror.Write(w, http.StatusBadRequest, apierror.SelfFriendRequest, "You cannot send a friend request to yourself")
 		return
 	}
 
 	// Check if a friend request or relationship already exists (from sender to recipient)
-	senderToRecipientDocRef := db.Client.Collection("friends").Doc(requesterEmail + "_" + friendEmail)
+	senderToRecipientDocRef := db.Client.Collection("friends").Doc(requesterID + "_" + friendID)
 	senderToRecipientDocSnapshot, err := senderToRecipientDocRef.Get(db.Ctx)
 	if err == nil && senderToRecipientDocSnapshot.Exists() {
-		http.Error(w, "Friend request already exists or you are already friends", http.StatusConflict)
+		apierror.Write(w, http.StatusConflict, apierror.FriendRequestExists, "Friend request already exists or you are already friends")
 		return
 	}
 
 	// Check if a friend request exists from the recipient to the sender (recipient already sent a request)
-	recipientToSenderDocRef := db.Client.Collection("friends").Doc(friendEmail + "_" + requesterEmail)
+	recipientToSenderDocRef := db.Client.Collection("friends").Doc(friendID + "_" + requesterID)
 	recipientToSenderDocSnapshot, err := recipientToSenderDocRef.Get(db.Ctx)
 	if err == nil && recipientToSenderDocSnapshot.Exists() {
 		status := recipientToSenderDocSnapshot.Data()["Status"].(string)
 		if status == "pending" {
-			http.Error(w, "This user has already sent you a friend request. You can accept or decline it.", http.StatusConflict)
+			apierror.Write(w, http.StatusConflict, apierror.FriendRequestExists, "This user has already sent you a friend request. You can accept or decline it.")
 			return
 		}
 	}
 
 	// Create new friend request (pending)
 	friendRequest := model.Friend{
-		Email:       requesterEmail,
-		FriendEmail: friendEmail,
-		Status:      "pending",
+		UserID:   requesterID,
+		FriendID: friendID,
+		Status:   "pending",
 	}
 	_, err = senderToRecipientDocRef.Set(db.Ctx, friendRequest)
 	if err != nil {
-		http.Error(w, "Failed to send friend request", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send friend request")
 		return
 	}
 
@@ -73,31 +71,27 @@ func SendFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
 
 // AcceptFriendRequestByUsername allows users to accept friend requests using a username
 func AcceptFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Username string `json:"username"` // Username of the person who sent the friend request
-	}
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var requestBody model.UsernameRequest // Username of the person who sent the friend request
+	if !validation.DecodeJSON(w, r, &requestBody) {
 		return
 	}
 
-	// Get the acceptor's email from the JWT token context
-	requesterEmail := r.Context().Value("userEmail").(string)
+	// Get the acceptor's ID from the JWT token context
+	requesterID := r.Context().Value("userID").(string)
 
-	// Retrieve the email of the friend request sender by username
+	// Retrieve the ID of the friend request sender by username
 	senderDoc, err := db.Client.Collection("users").Where("Username", "==", requestBody.Username).Limit(1).Documents(db.Ctx).Next()
 	if err != nil {
-		http.Error(w, "Friend request sender not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "Friend request sender not found")
 		return
 	}
-	senderEmail := senderDoc.Data()["Email"].(string)
+	senderID := senderDoc.Ref.ID
 
 	// Check if there is a pending friend request from the sender
-	docRef := db.Client.Collection("friends").Doc(senderEmail + "_" + requesterEmail)
+	docRef := db.Client.Collection("friends").Doc(senderID + "_" + requesterID)
 	docSnapshot, err := docRef.Get(db.Ctx)
 	if err != nil || !docSnapshot.Exists() || docSnapshot.Data()["Status"].(string) != "pending" {
-		http.Error(w, "Friend request not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.FriendRequestNotFound, "Friend request not found")
 		return
 	}
 
@@ -106,20 +100,20 @@ func AcceptFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
 		{Path: "Status", Value: "accepted"},
 	})
 	if err != nil {
-		http.Error(w, "Failed to accept friend request", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to accept friend request")
 		return
 	}
 
 	// Create the reciprocal relationship in the database
-	reciprocalDocRef := db.Client.Collection("friends").Doc(requesterEmail + "_" + senderEmail)
+	reciprocalDocRef := db.Client.Collection("friends").Doc(requesterID + "_" + senderID)
 	reciprocalFriend := model.Friend{
-		Email:       requesterEmail,
-		FriendEmail: senderEmail,
-		Status:      "accepted",
+		UserID:   requesterID,
+		FriendID: senderID,
+		Status:   "accepted",
 	}
 	_, err = reciprocalDocRef.Set(db.Ctx, reciprocalFriend)
 	if err != nil {
-		http.Error(w, "Failed to create reciprocal friend relationship", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create reciprocal friend relationship")
 		return
 	}
 
@@ -129,38 +123,34 @@ func AcceptFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
 
 // RemoveFriend allows users to remove friends
 func RemoveFriend(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Username string `json:"username"` // Username of the friend to remove
-	}
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var requestBody model.UsernameRequest // Username of the friend to remove
+	if !validation.DecodeJSON(w, r, &requestBody) {
 		return
 	}
 
-	// Get the remover's email from the JWT token context
-	requesterEmail := r.Context().Value("userEmail").(string)
+	// Get the remover's ID from the JWT token context
+	requesterID := r.Context().Value("userID").(string)
 
-	// Retrieve the email of the friend by username
+	// Retrieve the ID of the friend by username
 	friendDoc, err := db.Client.Collection("users").Where("Username", "==", requestBody.Username).Limit(1).Documents(db.Ctx).Next()
 	if err != nil {
-		http.Error(w, "Friend not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "Friend not found")
 		return
 	}
-	friendEmail := friendDoc.Data()["Email"].(string)
+	friendID := friendDoc.Ref.ID
 
 	// Remove both relationships from the database
-	docRef := db.Client.Collection("friends").Doc(requesterEmail + "_" + friendEmail)
+	docRef := db.Client.Collection("friends").Doc(requesterID + "_" + friendID)
 	_, err = docRef.Delete(db.Ctx)
 	if err != nil {
-		http.Error(w, "Failed to remove friend", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to remove friend")
 		return
 	}
 
-	reciprocalDocRef := db.Client.Collection("friends").Doc(friendEmail + "_" + requesterEmail)
+	reciprocalDocRef := db.Client.Collection("friends").Doc(friendID + "_" + requesterID)
 	_, err = reciprocalDocRef.Delete(db.Ctx)
 	if err != nil {
-		http.Error(w, "Failed to remove reciprocal friend", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to remove reciprocal friend")
 		return
 	}
 
@@ -170,29 +160,29 @@ func RemoveFriend(w http.ResponseWriter, r *http.Request) {
 
 // GetFriendsList fetches all friends of the logged-in user
 func GetFriendsList(w http.ResponseWriter, r *http.Request) {
-	// Retrieve the user's email from JWT token context
-	userEmail := r.Context().Value("userEmail").(string)
+	// Retrieve the user's ID from JWT token context
+	userID := r.Context().Value("userID").(string)
 
 	// Query accepted friends
-	docs, err := db.Client.Collection("friends").Where("Email", "==", userEmail).Where("Status", "==", "accepted").Documents(db.Ctx).GetAll()
+	docs, err := db.Client.Collection("friends").Where("UserID", "==", userID).Where("Status", "==", "accepted").Documents(db.Ctx).GetAll()
 	if err != nil {
-		http.Error(w, "Failed to fetch friends", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch friends")
 		return
 	}
 
 	var friends []string
 	for _, doc := range docs {
-		friendEmail := doc.Data()["FriendEmail"].(string)
+		friendID := doc.Data()["FriendID"].(string)
 
-		// Fetch the friend's username using their email
-		friendDoc, err := db.Client.Collection("users").Doc(friendEmail).Get(db.Ctx)
+		// Fetch the friend's username using their ID
+		friendDoc, err := db.Client.Collection("users").Doc(friendID).Get(db.Ctx)
 		if err != nil {
-			http.Error(w, "Failed to fetch friend's username", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch friend's username")
 			return
 		}
 		friendUsername := friendDoc.Data()["Username"].(string)
 
-		friends = append(friends, friendUsername) // Return username instead of email
+		friends = append(friends, friendUsername) // Return username instead of ID
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -201,17 +191,17 @@ func GetFriendsList(w http.ResponseWriter, r *http.Request) {
 
 // GetPendingFriendRequests retrieves all pending friend requests for the logged-in user
 func GetPendingFriendRequests(w http.ResponseWriter, r *http.Request) {
-	// Get the user's email from the JWT token context
-	userEmail := r.Context().Value("userEmail").(string)
+	// Get the user's ID from the JWT token context
+	userID := r.Context().Value("userID").(string)
 
-	// Query for pending friend requests where the current user is the friendEmail (recipient)
+	// Query for pending friend requests where the current user is the recipient
 	docs, err := db.Client.Collection("friends").
-		Where("FriendEmail", "==", userEmail).
+		Where("FriendID", "==", userID).
 		Where("Status", "==", "pending").
 		Documents(db.Ctx).GetAll()
 
 	if err != nil || len(docs) == 0 {
-		http.Error(w, "No pending friend requests found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.FriendRequestNotFound, "No pending friend requests found")
 		return
 	}
 
@@ -219,11 +209,11 @@ func GetPendingFriendRequests(w http.ResponseWriter, r *http.Request) {
 	for _, doc := range docs {
 		data := doc.Data()
 
-		// Query to get the sender's username from their email
-		senderEmail := data["Email"].(string)
-		senderDoc, err := db.Client.Collection("users").Doc(senderEmail).Get(db.Ctx)
+		// Query to get the sender's username from their ID
+		senderID := data["UserID"].(string)
+		senderDoc, err := db.Client.Collection("users").Doc(senderID).Get(db.Ctx)
 		if err != nil {
-			http.Error(w, "Failed to fetch sender's username", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch sender's username")
 			return
 		}
 		senderUsername := senderDoc.Data()["Username"].(string)
@@ -240,38 +230,34 @@ func GetPendingFriendRequests(w http.ResponseWriter, r *http.Request) {
 
 // DeclineFriendRequestByUsername allows users to decline friend requests using a username
 func DeclineFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Username string `json:"username"` // Username of the person who sent the friend request
-	}
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var requestBody model.UsernameRequest // Username of the person who sent the friend request
+	if !validation.DecodeJSON(w, r, &requestBody) {
 		return
 	}
 
-	// Get the current user's email from JWT token context
-	requesterEmail := r.Context().Value("userEmail").(string)
+	// Get the current user's ID from JWT token context
+	requesterID := r.Context().Value("userID").(string)
 
-	// Retrieve the email of the friend request sender by username
+	// Retrieve the ID of the friend request sender by username
 	senderDoc, err := db.Client.Collection("users").Where("Username", "==", requestBody.Username).Limit(1).Documents(db.Ctx).Next()
 	if err != nil {
-		http.Error(w, "Friend request sender not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "Friend request sender not found")
 		return
 	}
-	senderEmail := senderDoc.Data()["Email"].(string)
+	senderID := senderDoc.Ref.ID
 
 	// Check if there is a pending friend request from the sender
-	docRef := db.Client.Collection("friends").Doc(senderEmail + "_" + requesterEmail)
+	docRef := db.Client.Collection("friends").Doc(senderID + "_" + requesterID)
 	docSnapshot, err := docRef.Get(db.Ctx)
 	if err != nil || !docSnapshot.Exists() || docSnapshot.Data()["Status"].(string) != "pending" {
-		http.Error(w, "Friend request not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.FriendRequestNotFound, "Friend request not found")
 		return
 	}
 
 	// Remove the friend request from the database (or alternatively, update its status to 'declined')
 	_, err = docRef.Delete(db.Ctx)
 	if err != nil {
-		http.Error(w, "Failed to decline friend request", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decline friend request")
 		return
 	}
 
@@ -281,38 +267,34 @@ func DeclineFriendRequestByUsername(w http.ResponseWriter, r *http.Request) {
 
 // CancelFriendRequest allows users to cancel a pending friend request
 func CancelFriendRequest(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Username string `json:"username"` // The username of the recipient of the friend request to cancel
-	}
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var requestBody model.UsernameRequest // The username of the recipient of the friend request to cancel
+	if !validation.DecodeJSON(w, r, &requestBody) {
 		return
 	}
 
-	// Retrieve the sender's email from JWT token context
-	requesterEmail := r.Context().Value("userEmail").(string)
+	// Retrieve the sender's ID from JWT token context
+	requesterID := r.Context().Value("userID").(string)
 
-	// Retrieve the email of the friend by username
+	// Retrieve the ID of the friend by username
 	doc, err := db.Client.Collection("users").Where("Username", "==", requestBody.Username).Limit(1).Documents(db.Ctx).Next()
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "User not found")
 		return
 	}
-	friendEmail := doc.Data()["Email"].(string)
+	friendID := doc.Ref.ID
 
 	// Check if a pending friend request exists
-	docRef := db.Client.Collection("friends").Doc(requesterEmail + "_" + friendEmail)
+	docRef := db.Client.Collection("friends").Doc(requesterID + "_" + friendID)
 	docSnapshot, err := docRef.Get(db.Ctx)
 	if err != nil || !docSnapshot.Exists() || docSnapshot.Data()["Status"].(string) != "pending" {
-		http.Error(w, "Pending friend request not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.FriendRequestNotFound, "Pending friend request not found")
 		return
 	}
 
 	// Delete the friend request
 	_, err = docRef.Delete(db.Ctx)
 	if err != nil {
-		http.Error(w, "Failed to cancel friend request", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to cancel friend request")
 		return
 	}
 
@@ -4,12 +4,9 @@ import (
 	"backend/model"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
-	"math/rand"
-	"net/http"
 	"os"
+	"strings"
 	"time"
 	"unicode"
 )
@@ -18,15 +15,30 @@ import (
 var jwtSecretKey = os.Getenv("JWT_SECRET_KEY")
 
 // Utility function to generate JWT token for a user
-func GenerateJWT(email string) (string, error) {
+func GenerateJWT(userID string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &model.Claims{
-		Email: email,
+	return signJWT(&model.Claims{
+		UserID: userID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
-	}
+	})
+}
 
+// GenerateMFAPendingJWT issues the token for the second step of a login with two-factor
+// authentication. It expires after five minutes and only works for that step.
+func GenerateMFAPendingJWT(userID string) (string, error) {
+	expirationTime := time.Now().Add(5 * time.Minute)
+	return signJWT(&model.Claims{
+		UserID:     userID,
+		MFAPending: true,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+		},
+	})
+}
+
+func signJWT(claims *model.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(jwtSecretKey))
 	if err != nil {
@@ -36,12 +48,6 @@ func GenerateJWT(email string) (string, error) {
 	return tokenString, nil
 }
 
-// used in Forgotpassword
-func GenerateOTP() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
-}
-
 // used in userlogin and usersignup Resetpassword
 // Utility function to hash password using SHA-256
 func HashPassword(password string) string {
@@ -70,11 +76,12 @@ func IsValidPassword(password string) bool {
 	return hasMinLen && hasUpper && hasNumber && hasSpecial
 }
 
-// writeJSONError sends a JSON-formatted error response
-func WriteJSONError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": message,
-	})
+// AppURL returns the address of a page of the frontend at APP_URL (default
+// http://localhost:3000), for links in emails
+func AppURL(page string) string {
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:3000"
+	}
+	return strings.TrimRight(appURL, "/") + page
 }
@@ -0,0 +1,68 @@
+package identity
+
+import (
+	"backend/db"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+)
+
+// Users are stored at users/{userID}, where the ID is a random UUID that never changes.
+// The email address is an ordinary, changeable field; emails/{address} maps each
+// address to its user, which keeps addresses unique and makes login a single lookup.
+
+// emailRecord is the document stored at emails/{address}
+type emailRecord struct {
+	UserID string
+}
+
+// NewUserID returns a new random user ID
+func NewUserID() string {
+	return uuid.NewString()
+}
+
+// UserRef returns the document of the user with the given ID
+func UserRef(userID string) *firestore.DocumentRef {
+	return db.Client.Collection("users").Doc(userID)
+}
+
+// EmailRef returns the index document for an email address. Addresses are compared
+// without regard to case.
+func EmailRef(email string) *firestore.DocumentRef {
+	return db.Client.Collection("emails").Doc(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// UserIDByEmail returns the ID of the user registered with email. When no user has the
+// address the error has gRPC status code NotFound.
+func UserIDByEmail(email string) (string, error) {
+	doc, err := EmailRef(email).Get(db.Ctx)
+	if err != nil {
+		return "", err
+	}
+	var record emailRecord
+	if err := doc.DataTo(&record); err != nil {
+		return "", err
+	}
+	return record.UserID, nil
+}
+
+// UserByEmail reads the document of the user registered with email
+func UserByEmail(email string) (*firestore.DocumentSnapshot, error) {
+	userID, err := UserIDByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	return UserRef(userID).Get(db.Ctx)
+}
+
+// Reserve registers email to userID inside tx. The transaction fails with status code
+// AlreadyExists if another user has the address.
+func Reserve(tx *firestore.Transaction, email, userID string) error {
+	return tx.Create(EmailRef(email), emailRecord{UserID: userID})
+}
+
+// Release frees email for other users inside tx
+func Release(tx *firestore.Transaction, email string) error {
+	return tx.Delete(EmailRef(email))
+}
@@ -0,0 +1,81 @@
+package journal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Above this many LCS cells the diff falls back from words to whole lines
+const maxDiffCells = 4_000_000
+
+var diffTokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+// DiffChange is one run of text in a diff: "equal", "insert" or "delete"
+type DiffChange struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// diffText returns the changes that turn oldText into newText, word by word
+func diffText(oldText, newText string) []DiffChange {
+	a := diffTokenPattern.FindAllString(oldText, -1)
+	b := diffTokenPattern.FindAllString(newText, -1)
+	if len(a)*len(b) > maxDiffCells {
+		a = strings.SplitAfter(oldText, "\n")
+		b = strings.SplitAfter(newText, "\n")
+	}
+	return diffTokens(a, b)
+}
+
+// diffTokens computes a longest-common-subsequence diff of two token lists
+func diffTokens(a, b []string) []DiffChange {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	changes := []DiffChange{}
+	add := func(op, text string) {
+		// Merge consecutive tokens with the same op into one change
+		if n := len(changes); n > 0 && changes[n-1].Op == op {
+			changes[n-1].Text += text
+			return
+		}
+		changes = append(changes, DiffChange{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add("equal", a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add("delete", a[i])
+			i++
+		default:
+			add("insert", b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add("delete", a[i])
+	}
+	for ; j < len(b); j++ {
+		add("insert", b[j])
+	}
+	return changes
+}
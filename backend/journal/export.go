@@ -0,0 +1,154 @@
+package journal
+
+import (
+	"archive/zip"
+	"backend/apierror"
+	"backend/model"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportJournalsHandler streams all of the logged-in user's journal entries as a download.
+// format=md (default) and format=json produce a zip with one file per date;
+// format=pdf produces a single paginated PDF.
+func ExportJournalsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "md"
+	}
+	if format != "md" && format != "json" && format != "pdf" {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidRequest, "Invalid format. Use md, pdf or json.")
+		return
+	}
+
+	filename := "dailyverse-journal-" + time.Now().Format("2006-01-02")
+	var err error
+	switch format {
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.pdf"`)
+		err = exportPDF(w, userID)
+	default:
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`-`+format+`.zip"`)
+		err = exportZip(w, userID, format)
+	}
+
+	// Headers are already sent once streaming starts, so a failure can only be logged
+	if err != nil {
+		log.Printf("Failed to export journals for %s: %v", userID, err)
+	}
+}
+
+// exportZip writes one file per journal entry into a zip archive.
+// Entries sharing a date get a numeric suffix: 2024-11-10.md, 2024-11-10-2.md.
+func exportZip(w io.Writer, userID, format string) error {
+	archive := zip.NewWriter(w)
+
+	previousDate := ""
+	sameDate := 0
+	err := forEachJournal(userID, func(journal model.Journal) error {
+		if journal.Date == previousDate {
+			sameDate++
+		} else {
+			previousDate, sameDate = journal.Date, 1
+		}
+		name := journal.Date
+		if sameDate > 1 {
+			name += "-" + strconv.Itoa(sameDate)
+		}
+
+		file, err := archive.Create(name + "." + format)
+		if err != nil {
+			return err
+		}
+		if format == "json" {
+			journal.HTML = ""
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(journal)
+		}
+		_, err = io.WriteString(file, markdownWithFrontMatter(journal))
+		return err
+	})
+	if err != nil {
+		archive.Close()
+		return err
+	}
+	return archive.Close()
+}
+
+// markdownWithFrontMatter renders a journal entry as a Markdown file with YAML front matter
+func markdownWithFrontMatter(journal model.Journal) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "date: %s\n", journal.Date)
+	fmt.Fprintf(&b, "journalID: %s\n", journal.JournalID)
+	if journal.Title != "" {
+		fmt.Fprintf(&b, "title: %s\n", strconv.Quote(journal.Title))
+	}
+	if journal.Mood != 0 {
+		fmt.Fprintf(&b, "mood: %d\n", journal.Mood)
+	}
+	if len(journal.Tags) > 0 {
+		quoted := make([]string, len(journal.Tags))
+		for i, tag := range journal.Tags {
+			quoted[i] = strconv.Quote(tag)
+		}
+		fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(quoted, ", "))
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(journal.Content)
+	if !strings.HasSuffix(journal.Content, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// exportPDF writes every journal entry into one paginated PDF, oldest first
+func exportPDF(w io.Writer, userID string) error {
+	pdf := newPDFWriter(w)
+	pdf.Text("DailyVerse journal", 20, true)
+	pdf.Text("Exported "+time.Now().Format("2006-01-02"), 10, false)
+	pdf.Space(16)
+
+	err := forEachJournal(userID, func(journal model.Journal) error {
+		heading := journal.Date
+		if journal.Title != "" {
+			heading += " - " + journal.Title
+		}
+		pdf.Text(heading, 14, true)
+
+		var meta []string
+		if journal.Mood != 0 {
+			meta = append(meta, fmt.Sprintf("Mood: %d/5", journal.Mood))
+		}
+		if len(journal.Tags) > 0 {
+			meta = append(meta, "Tags: "+strings.Join(journal.Tags, ", "))
+		}
+		if len(meta) > 0 {
+			pdf.Text(strings.Join(meta, "   "), 9, false)
+		}
+
+		pdf.Space(4)
+		pdf.Text(journal.Content, 11, false)
+		pdf.Space(18)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return pdf.Close()
+}
@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"backend/model"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Limits for the optional fields of a journal entry
+const (
+	minMood      = 1
+	maxMood      = 5
+	maxTags      = 20
+	maxTagLength = 32
+	maxTitleLen  = 200
+)
+
+// validateJournal checks the optional fields of a journal entry and normalizes its tags
+func validateJournal(journal *model.Journal) error {
+	journal.Title = strings.TrimSpace(journal.Title)
+	if len([]rune(journal.Title)) > maxTitleLen {
+		return errors.New("Title must be at most 200 characters")
+	}
+
+	if journal.Mood != 0 && (journal.Mood < minMood || journal.Mood > maxMood) {
+		return errors.New("Mood must be between 1 and 5")
+	}
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range journal.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return errors.New("Tags must be at most 32 characters")
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return errors.New("A journal entry can have at most 20 tags")
+	}
+	journal.Tags = tags
+
+	return nil
+}
+
+// journalFilter narrows a list of journal entries by tag and mood
+type journalFilter struct {
+	Tag     string
+	MinMood int
+	MaxMood int
+}
+
+// parseJournalFilter reads the tag, mood, minMood and maxMood query parameters
+func parseJournalFilter(r *http.Request) (journalFilter, error) {
+	query := r.URL.Query()
+	filter := journalFilter{Tag: strings.ToLower(strings.TrimSpace(query.Get("tag")))}
+
+	parseMood := func(name string) (int, error) {
+		value := query.Get(name)
+		if value == "" {
+			return 0, nil
+		}
+		mood, err := strconv.Atoi(value)
+		if err != nil || mood < minMood || mood > maxMood {
+			return 0, errors.New("Mood filters must be between 1 and 5")
+		}
+		return mood, nil
+	}
+
+	mood, err := parseMood("mood")
+	if err != nil {
+		return filter, err
+	}
+	if mood != 0 {
+		filter.MinMood, filter.MaxMood = mood, mood
+	}
+	if min, err := parseMood("minMood"); err != nil {
+		return filter, err
+	} else if min != 0 {
+		filter.MinMood = min
+	}
+	if max, err := parseMood("maxMood"); err != nil {
+		return filter, err
+	} else if max != 0 {
+		filter.MaxMood = max
+	}
+
+	return filter, nil
+}
+
+// matches reports whether a decrypted journal entry passes the filter
+func (f journalFilter) matches(journal model.Journal) bool {
+	if f.Tag != "" {
+		found := false
+		for _, tag := range journal.Tags {
+			if tag == f.Tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.MinMood != 0 && journal.Mood < f.MinMood {
+		return false
+	}
+	if f.MaxMood != 0 && (journal.Mood == 0 || journal.Mood > f.MaxMood) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,389 @@
+package journal
+
+import (
+	"archive/zip"
+	"backend/apierror"
+	"backend/db"
+	"backend/model"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits that keep a malicious archive from exhausting memory
+const (
+	maxImportUpload   = 20 << 20 // 20 MB
+	maxImportFileSize = 5 << 20  // 5 MB per file inside a zip
+	maxImportUnpacked = 50 << 20 // 50 MB for all files of a zip together
+	maxImportEntries  = 5000
+)
+
+var filenameDatePattern = regexp.MustCompile(`(\d{4}-\d{2}-\d{2})`)
+
+// ImportedEntry describes what happened (or would happen, in a dry run) to one imported entry
+type ImportedEntry struct {
+	Source    string `json:"source"`
+	Date      string `json:"date,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Section   int    `json:"section,omitempty"`
+	Status    string `json:"status"` // "new", "duplicate" or "invalid"
+	Reason    string `json:"reason,omitempty"`
+	JournalID string `json:"journalID,omitempty"`
+	journal   model.Journal
+}
+
+// dayOneExport is the subset of the Day One JSON export format that maps onto a journal entry
+type dayOneExport struct {
+	Entries []struct {
+		CreationDate string   `json:"creationDate"`
+		TimeZone     string   `json:"timeZone"`
+		Text         string   `json:"text"`
+		Tags         []string `json:"tags"`
+		Starred      bool     `json:"starred"`
+	} `json:"entries"`
+}
+
+// ImportJournalsHandler imports journal entries from an uploaded file (form field "file"):
+// a zip of Markdown files dated by front matter or filename, a Day One JSON export,
+// or a zip containing a Day One export. With dryRun=true nothing is written and the
+// response only previews which entries are new, duplicates or invalid.
+func ImportJournalsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportUpload)
+	if err := r.ParseMultipartForm(maxImportUpload); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidBody, "Failed to parse multipart form")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidBody, "Failed to read file")
+		return
+	}
+
+	entries, err := parseImport(header.Filename, data)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+
+	// Index what the user already has so duplicates can be detected by date and content
+	// and so entries for a date that already has one are added as extra sections
+	existing := make(map[string]bool)
+	nextSections := make(map[string]int)
+	err = forEachJournal(userID, func(journal model.Journal) error {
+		existing[duplicateKey(journal)] = true
+		if journal.Section >= nextSections[journal.Date] {
+			nextSections[journal.Date] = journal.Section + 1
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve journals")
+		return
+	}
+
+	counts := map[string]int{"new": 0, "duplicate": 0, "invalid": 0}
+	journals := db.Client.Collection("users").Doc(userID).Collection("journals")
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Status == "" {
+			key := duplicateKey(entry.journal)
+			if existing[key] {
+				entry.Status = "duplicate"
+			} else {
+				entry.Status = "new"
+				existing[key] = true
+				entry.Section = nextSections[entry.Date]
+				entry.journal.Section = entry.Section
+				nextSections[entry.Date]++
+			}
+		}
+		counts[entry.Status]++
+
+		if dryRun || entry.Status != "new" {
+			continue
+		}
+
+		journal := entry.journal
+		journal.UserID = userID
+		if err := sealJournal(userID, &journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encrypt journal")
+			return
+		}
+		docRef := journals.NewDoc()
+		journal.JournalID = docRef.ID
+		if _, err := docRef.Set(db.Ctx, journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to import journal")
+			return
+		}
+		entry.JournalID = docRef.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dryRun":     dryRun,
+		"imported":   counts["new"],
+		"duplicates": counts["duplicate"],
+		"invalid":    counts["invalid"],
+		"entries":    entries,
+	})
+}
+
+// duplicateKey identifies an entry by its date and a hash of its trimmed content
+func duplicateKey(journal model.Journal) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(journal.Content)))
+	return journal.Date + ":" + hex.EncodeToString(sum[:])
+}
+
+// parseImport detects the upload format and returns the entries it contains
+func parseImport(filename string, data []byte) ([]ImportedEntry, error) {
+	if bytes.HasPrefix(data, []byte("PK")) {
+		return parseZipImport(data)
+	}
+	if strings.HasSuffix(strings.ToLower(filename), ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseDayOne(filename, data)
+	}
+	return nil, errors.New("Unsupported file. Upload a zip of Markdown files or a Day One JSON export.")
+}
+
+func parseZipImport(data []byte) ([]ImportedEntry, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("Invalid zip file")
+	}
+
+	var entries []ImportedEntry
+	unpacked := 0
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(path.Base(f.Name), ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".md" && ext != ".markdown" && ext != ".txt" && ext != ".json" {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			entries = append(entries, ImportedEntry{Source: f.Name, Status: "invalid", Reason: err.Error()})
+			continue
+		}
+		// Declared sizes can lie, so count what was actually unpacked
+		if unpacked += len(content); unpacked > maxImportUnpacked {
+			return nil, errors.New("Zip is too large once unpacked")
+		}
+
+		if ext == ".json" {
+			dayOne, err := parseDayOne(f.Name, content)
+			if err != nil {
+				entries = append(entries, ImportedEntry{Source: f.Name, Status: "invalid", Reason: err.Error()})
+				continue
+			}
+			entries = append(entries, dayOne...)
+		} else {
+			entries = append(entries, parseMarkdownEntry(f.Name, string(content)))
+		}
+
+		if len(entries) > maxImportEntries {
+			return nil, errors.New("Too many entries in one import")
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("No Markdown or Day One files found in zip")
+	}
+	return entries, nil
+}
+
+// readZipFile reads a file from a zip without trusting its declared size
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, errors.New("Failed to open file")
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxImportFileSize+1))
+	if err != nil {
+		return nil, errors.New("Failed to read file")
+	}
+	if len(content) > maxImportFileSize {
+		return nil, errors.New("File is too large")
+	}
+	return content, nil
+}
+
+// parseMarkdownEntry reads a Markdown file with optional front matter (date, title, mood, tags).
+// Without a date in the front matter, the first YYYY-MM-DD in the filename is used.
+func parseMarkdownEntry(name, text string) ImportedEntry {
+	entry := ImportedEntry{Source: name}
+	journal := model.Journal{}
+
+	text = strings.TrimPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "\ufeff")
+	if strings.HasPrefix(text, "---\n") {
+		if end := strings.Index(text[4:], "\n---"); end >= 0 {
+			frontMatter := text[4 : 4+end]
+			text = strings.TrimPrefix(text[4+end+4:], "\n")
+			if err := applyFrontMatter(frontMatter, &journal); err != nil {
+				entry.Status, entry.Reason = "invalid", err.Error()
+				return entry
+			}
+		}
+	}
+	journal.Content = strings.TrimSpace(text)
+
+	if journal.Date == "" {
+		if m := filenameDatePattern.FindString(path.Base(name)); m != "" {
+			journal.Date = m
+		}
+	}
+
+	return finishImportedEntry(entry, journal)
+}
+
+// applyFrontMatter parses the simple "key: value" YAML front matter written by the Markdown export
+func applyFrontMatter(frontMatter string, journal *model.Journal) error {
+	lastKey := ""
+	for _, line := range strings.Split(frontMatter, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// Block list item continuing the previous key, e.g. "tags:\n  - travel"
+		if strings.HasPrefix(trimmed, "- ") && lastKey == "tags" {
+			journal.Tags = append(journal.Tags, unquote(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+
+		parts := strings.SplitN(trimmed, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		lastKey = key
+
+		switch key {
+		case "date":
+			// Accept full timestamps as well as plain dates
+			date := unquote(value)
+			if len(date) > 10 {
+				date = date[:10]
+			}
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return errors.New("Date must be in YYYY-MM-DD format")
+			}
+			journal.Date = date
+		case "title":
+			journal.Title = unquote(value)
+		case "mood":
+			mood, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.New("Mood must be a number between 1 and 5")
+			}
+			journal.Mood = mood
+		case "tags":
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+			for _, tag := range strings.Split(value, ",") {
+				if tag = unquote(strings.TrimSpace(tag)); tag != "" {
+					journal.Tags = append(journal.Tags, tag)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func unquote(value string) string {
+	if s, err := strconv.Unquote(value); err == nil {
+		return s
+	}
+	return strings.Trim(value, `'"`)
+}
+
+// parseDayOne maps the entries of a Day One JSON export onto journal entries,
+// using each entry's own time zone to decide which day it belongs to
+func parseDayOne(name string, data []byte) ([]ImportedEntry, error) {
+	var export dayOneExport
+	if err := json.Unmarshal(data, &export); err != nil || export.Entries == nil {
+		return nil, errors.New("Invalid Day One export")
+	}
+	if len(export.Entries) > maxImportEntries {
+		return nil, errors.New("Too many entries in one import")
+	}
+
+	entries := make([]ImportedEntry, 0, len(export.Entries))
+	for i, e := range export.Entries {
+		entry := ImportedEntry{Source: name + "#" + strconv.Itoa(i+1)}
+		journal := model.Journal{Content: strings.TrimSpace(e.Text), Tags: e.Tags}
+
+		created, err := time.Parse(time.RFC3339, e.CreationDate)
+		if err == nil {
+			if loc, err := time.LoadLocation(e.TimeZone); err == nil && e.TimeZone != "" {
+				created = created.In(loc)
+			}
+			journal.Date = created.Format("2006-01-02")
+		}
+
+		// Day One stores the title as a leading Markdown heading
+		if strings.HasPrefix(journal.Content, "# ") {
+			firstLine, rest, _ := strings.Cut(journal.Content, "\n")
+			journal.Title = strings.TrimSpace(strings.TrimPrefix(firstLine, "# "))
+			journal.Content = strings.TrimSpace(rest)
+		}
+
+		entries = append(entries, finishImportedEntry(entry, journal))
+	}
+	return entries, nil
+}
+
+// finishImportedEntry validates a parsed entry, marking it invalid if it cannot be imported
+func finishImportedEntry(entry ImportedEntry, journal model.Journal) ImportedEntry {
+	if entry.Status == "invalid" {
+		return entry
+	}
+
+	date, err := time.Parse("2006-01-02", journal.Date)
+	if err != nil {
+		entry.Status, entry.Reason = "invalid", "No valid date in front matter or filename"
+		return entry
+	}
+	journal.Date = date.Format("2006-01-02")
+
+	if journal.Content == "" {
+		entry.Status, entry.Reason = "invalid", "Entry is empty"
+		return entry
+	}
+	if err := validateJournal(&journal); err != nil {
+		entry.Status, entry.Reason = "invalid", err.Error()
+		return entry
+	}
+
+	entry.Date = journal.Date
+	entry.Title = journal.Title
+	entry.journal = journal
+	return entry
+}
@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"archive/zip"
+	"backend/model"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyFrontMatter(t *testing.T) {
+	tests := []struct {
+		name        string
+		frontMatter string
+		want        model.Journal
+		wantErr     bool
+	}{
+		{name: "plain date", frontMatter: "date: 2024-01-02", want: model.Journal{Date: "2024-01-02"}},
+		{name: "quoted date", frontMatter: `date: "2024-01-02"`, want: model.Journal{Date: "2024-01-02"}},
+		{name: "timestamp", frontMatter: "date: 2024-01-02T21:30:00+01:00", want: model.Journal{Date: "2024-01-02"}},
+		{name: "short quoted date", frontMatter: `date: "2024-1-1"`, wantErr: true},
+		{name: "not a date", frontMatter: "date: yesterday", wantErr: true},
+		{name: "impossible date", frontMatter: "date: 2024-02-30", wantErr: true},
+		{name: "bad mood", frontMatter: "mood: happy", wantErr: true},
+		{
+			name:        "all fields",
+			frontMatter: "date: 2024-03-04\ntitle: 'A day'\nmood: 4\ntags: [travel, \"family\"]",
+			want:        model.Journal{Date: "2024-03-04", Title: "A day", Mood: 4, Tags: []string{"travel", "family"}},
+		},
+		{
+			name:        "block list tags",
+			frontMatter: "tags:\n  - travel\n  - work",
+			want:        model.Journal{Tags: []string{"travel", "work"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got model.Journal
+			err := applyFrontMatter(tt.frontMatter, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyFrontMatter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyFrontMatter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseZipImportLimitsUnpackedSize(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	// Each file is within the per-file limit and compresses to almost nothing
+	content := "---\ndate: 2024-01-02\n---\n" + strings.Repeat("a", maxImportFileSize-100)
+	for i := 0; i*len(content) <= maxImportUnpacked; i++ {
+		f, err := archive.Create(strings.Repeat("x", i+1) + ".md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	archive.Close()
+
+	if _, err := parseZipImport(buf.Bytes()); err == nil {
+		t.Fatal("parseZipImport() accepted an archive larger than maxImportUnpacked")
+	}
+}
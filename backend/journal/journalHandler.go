@@ -1,42 +1,74 @@
 package journal
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/model"
+	"backend/validation"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
 
+	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
 )
 
 // CreateJournalHandler handles creating a new journal entry
 func CreateJournalHandler(w http.ResponseWriter, r *http.Request) {
-	var journal model.Journal
-	err := json.NewDecoder(r.Body).Decode(&journal)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
-	journalDate, err := time.Parse("2006-01-02", journal.Date)
-	if err != nil {
-		http.Error(w, "Invalid date format. Please use YYYY-MM-DD.", http.StatusBadRequest)
+	var journal model.Journal
+	if !validation.DecodeJSON(w, r, &journal) || !requireDate(w, &journal) {
 		return
 	}
-	journal.Date = journalDate.Format("2006-01-02")
-
-	userDocRef := db.Client.Collection("users").Doc(journal.Email).Collection("journals")
-	docRef, _, err := userDocRef.Add(db.Ctx, journal)
-	if err != nil {
-		http.Error(w, "Failed to create journal", http.StatusInternalServerError)
+	journal.SharedWith = nil // Sharing is managed through ShareJournalHandler
+	journal.Section = 0
+	if err := validateJournal(&journal); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+	journal.UserID = userID
+	if err := sealJournal(userID, &journal); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encrypt journal")
 		return
 	}
 
-	journal.JournalID = docRef.ID
-	_, err = docRef.Set(db.Ctx, journal)
+	// One main entry per day; further entries for the same day must opt in as sections
+	addSection := r.URL.Query().Get("section") == "new"
+	userDocRef := db.Client.Collection("users").Doc(userID).Collection("journals")
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing, err := tx.Documents(userDocRef.Where("Date", "==", journal.Date)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			if !addSection {
+				return &duplicateEntriesError{JournalIDs: []string{existing[0].Ref.ID}}
+			}
+			journal.Section = nextSection(existing)
+		}
+
+		docRef := userDocRef.NewDoc()
+		journal.JournalID = docRef.ID
+		return tx.Create(docRef, journal)
+	})
+
+	var duplicates *duplicateEntriesError
+	if errors.As(err, &duplicates) {
+		apierror.WriteError(w, http.StatusConflict, &apierror.Error{
+			Code:    apierror.JournalExists,
+			Message: "A journal entry already exists for this date. Update it with PUT /api/v1/journal-days/{date} or add a section with ?section=new.",
+			Meta:    map[string]interface{}{"journalID": duplicates.JournalIDs[0]},
+		})
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update journal with JournalID", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create journal")
 		return
 	}
 
@@ -47,46 +79,97 @@ func CreateJournalHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetJournalHandler retrieves a journal entry by its ID
+// GetJournalHandler retrieves a journal entry by its ID. The owner parameter is the user
+// ID of the entry's owner and defaults to the logged-in user; other users can only read
+// entries their friend has shared with them.
 func GetJournalHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, ok := r.Context().Value("userID").(string)
+	if !ok || requesterID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
 	journalID := r.URL.Query().Get("journalID")
-	userEmail := r.URL.Query().Get("email")
-	if journalID == "" || userEmail == "" {
-		http.Error(w, "Missing journalID or email parameter", http.StatusBadRequest)
+	userID := r.URL.Query().Get("owner")
+	if userID == "" {
+		userID = requesterID
+	}
+	if journalID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID parameter")
 		return
 	}
 
-	doc, err := db.Client.Collection("users").Doc(userEmail).Collection("journals").Doc(journalID).Get(db.Ctx)
+	doc, err := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID).Get(db.Ctx)
 	if err != nil || !doc.Exists() {
-		http.Error(w, "Journal not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.JournalNotFound, "Journal not found")
+		return
+	}
+
+	// Respond the same way as for a missing entry so private entries can't be probed
+	if !canReadJournal(requesterID, userID, doc) {
+		apierror.Write(w, http.StatusNotFound, apierror.JournalNotFound, "Journal not found")
 		return
 	}
 
+	var journal model.Journal
+	if err := doc.DataTo(&journal); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse journal data")
+		return
+	}
+	if err := openJournal(userID, &journal); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decrypt journal")
+		return
+	}
+
+	// Keep the stored field names in the response, with the decrypted values swapped in
 	journalData := doc.Data()
+	delete(journalData, "SearchTokens")
+	journalData["Title"] = journal.Title
+	journalData["Content"] = journal.Content
+	journalData["Tags"] = journal.Tags
+	journalData["HTML"] = journal.HTML
+	if requesterID != userID {
+		delete(journalData, "SharedWith")
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(journalData)
 }
 
-// UpdateJournalHandler updates an existing journal entry
+// UpdateJournalHandler updates an existing journal entry. Moving it to a date that already
+// has a main entry is refused, as in CreateJournalHandler.
 func UpdateJournalHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
 	journalID := r.URL.Query().Get("journalID")
-	userEmail := r.URL.Query().Get("email")
-	if journalID == "" || userEmail == "" {
-		http.Error(w, "Missing journalID or email parameter", http.StatusBadRequest)
+	if journalID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID parameter")
 		return
 	}
 
 	var journal model.Journal
-	err := json.NewDecoder(r.Body).Decode(&journal)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !validation.DecodeJSON(w, r, &journal) || !requireDate(w, &journal) {
+		return
+	}
+	if err := validateJournal(&journal); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+	journal.UserID = userID
+	journal.JournalID = journalID
+	if err := sealJournal(userID, &journal); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encrypt journal")
 		return
 	}
 
-	docRef := db.Client.Collection("users").Doc(userEmail).Collection("journals").Doc(journalID)
-	_, err = docRef.Set(db.Ctx, journal)
-	if err != nil {
-		http.Error(w, "Failed to update journal", http.StatusInternalServerError)
+	docRef := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID)
+
+	// The version being overwritten is kept so it can be restored later
+	if !writeReplaceError(w, replaceJournal(docRef, &journal), "Failed to update journal") {
 		return
 	}
 
@@ -96,19 +179,70 @@ func UpdateJournalHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// writeReplaceError writes the error response for a failed replaceJournal and reports
+// whether err was nil
+func writeReplaceError(w http.ResponseWriter, err error, message string) bool {
+	var duplicates *duplicateEntriesError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errJournalNotFound):
+		apierror.Write(w, http.StatusNotFound, apierror.JournalNotFound, "Journal not found")
+	case errors.As(err, &duplicates):
+		apierror.WriteError(w, http.StatusConflict, &apierror.Error{
+			Code:    apierror.JournalExists,
+			Message: "A journal entry already exists for this date. Update that entry instead.",
+			Meta:    map[string]interface{}{"journalID": duplicates.JournalIDs[0]},
+		})
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, message)
+	}
+	return false
+}
+
+// requireDate rejects a journal body without a date. The date is optional on the model
+// because PUT /api/v1/journal-days/{date} takes it from the path.
+func requireDate(w http.ResponseWriter, journal *model.Journal) bool {
+	if journal.Date == "" {
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.ValidationFailed, "Some fields are invalid",
+			[]apierror.FieldError{{Field: "date", Message: "is required"}})
+		return false
+	}
+	return true
+}
+
 // DeleteJournalHandler deletes a journal entry by ID
 func DeleteJournalHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
 	journalID := r.URL.Query().Get("journalID")
-	userEmail := r.URL.Query().Get("email")
-	if journalID == "" || userEmail == "" {
-		http.Error(w, "Missing journalID or email parameter", http.StatusBadRequest)
+	if journalID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID parameter")
 		return
 	}
 
-	docRef := db.Client.Collection("users").Doc(userEmail).Collection("journals").Doc(journalID)
-	_, err := docRef.Delete(db.Ctx)
+	docRef := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID)
+
+	// Firestore does not delete subcollections with their parent, so remove revisions first
+	revisions, err := docRef.Collection("revisions").Documents(db.Ctx).GetAll()
 	if err != nil {
-		http.Error(w, "Failed to delete journal", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to delete journal revisions")
+		return
+	}
+	for _, revision := range revisions {
+		if _, err := revision.Ref.Delete(db.Ctx); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to delete journal revisions")
+			return
+		}
+	}
+
+	_, err = docRef.Delete(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to delete journal")
 		return
 	}
 
@@ -120,39 +254,72 @@ func DeleteJournalHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetAllJournalsHandler fetches all journal entries for the logged-in user
 func GetAllJournalsHandler(w http.ResponseWriter, r *http.Request) {
-	userEmail := r.URL.Query().Get("email")
-	if userEmail == "" {
-		http.Error(w, "Missing email parameter", http.StatusBadRequest)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
-	userDocRef := db.Client.Collection("users").Doc(userEmail).Collection("journals")
-	iter := userDocRef.Documents(db.Ctx)
+	filter, err := parseJournalFilter(r)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+
+	all, err := ListJournals(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve journals")
+		return
+	}
 
 	var journals []model.Journal
+	for _, journal := range all {
+		if filter.matches(journal) {
+			journals = append(journals, journal)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(journals)
+}
+
+// forEachJournal decrypts the user's journal entries one at a time in date order and
+// passes each to fn, so callers can stream entries without holding them all in memory
+func forEachJournal(userID string, fn func(model.Journal) error) error {
+	iter := db.Client.Collection("users").Doc(userID).Collection("journals").OrderBy("Date", firestore.Asc).Documents(db.Ctx)
+	defer iter.Stop()
 
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
-			break
+			return nil
 		}
 		if err != nil {
-			http.Error(w, "Failed to retrieve journals", http.StatusInternalServerError)
-			return
+			return err
 		}
 
 		var journal model.Journal
-		err = doc.DataTo(&journal)
-		if err != nil {
-			http.Error(w, "Failed to parse journal data", http.StatusInternalServerError)
-			return
+		if err := doc.DataTo(&journal); err != nil {
+			return err
+		}
+		if err := openJournal(userID, &journal); err != nil {
+			return err
 		}
 
 		// Get the document ID from the reference
-		journal.JournalID = doc.Ref.ID // Set the JournalID to the document ID
-		journals = append(journals, journal)
+		journal.JournalID = doc.Ref.ID
+		if err := fn(journal); err != nil {
+			return err
+		}
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(journals)
+// ListJournals loads and decrypts every journal entry of a user, oldest first
+func ListJournals(userID string) ([]model.Journal, error) {
+	var journals []model.Journal
+	err := forEachJournal(userID, func(journal model.Journal) error {
+		journals = append(journals, journal)
+		return nil
+	})
+	return journals, err
 }
@@ -0,0 +1,172 @@
+package journal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4 page layout in PDF points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 56
+)
+
+// pdfWriter writes a paginated text-only PDF to w as pages fill up, so only the
+// current page is ever held in memory. Object 1 is the catalog, 2 the page tree
+// (written last, once every page is known) and 3/4 the regular and bold fonts.
+type pdfWriter struct {
+	w       io.Writer
+	offset  int
+	offsets map[int]int // object number -> byte offset, for the xref table
+	nextObj int
+	pages   []int
+	page    bytes.Buffer
+	y       float64
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	p := &pdfWriter{w: w, offsets: make(map[int]int), nextObj: 5}
+	p.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	p.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	p.object(4, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	p.y = pdfPageHeight - pdfMargin
+	return p
+}
+
+func (p *pdfWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	n, err := io.WriteString(p.w, s)
+	p.offset += n
+	p.err = err
+}
+
+func (p *pdfWriter) object(num int, body string) {
+	p.offsets[num] = p.offset
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", num, body))
+}
+
+// flushPage writes the current page's content stream and page object
+func (p *pdfWriter) flushPage() {
+	pageNumber := len(p.pages) + 1
+	fmt.Fprintf(&p.page, "BT /F1 9 Tf %d %d Td (%d) Tj ET\n", pdfPageWidth/2, pdfMargin/2, pageNumber)
+
+	contentObj, pageObj := p.nextObj, p.nextObj+1
+	p.nextObj += 2
+	p.object(contentObj, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.page.Len(), p.page.String()))
+	p.object(pageObj, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+		"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+		pdfPageWidth, pdfPageHeight, contentObj))
+
+	p.pages = append(p.pages, pageObj)
+	p.page.Reset()
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// Text writes wrapped text in the given font size, breaking pages as needed
+func (p *pdfWriter) Text(text string, size float64, bold bool) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	// Helvetica averages a little over half an em per character
+	maxChars := int(float64(pdfPageWidth-2*pdfMargin) / (size * 0.52))
+	leading := size * 1.35
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, line := range wrapLine(paragraph, maxChars) {
+			if p.y-leading < pdfMargin {
+				p.flushPage()
+			}
+			p.y -= leading
+			fmt.Fprintf(&p.page, "BT /%s %.1f Tf %d %.1f Td (%s) Tj ET\n", font, size, pdfMargin, p.y, pdfString(line))
+		}
+	}
+}
+
+// Space adds vertical whitespace
+func (p *pdfWriter) Space(points float64) {
+	p.y -= points
+}
+
+// Close finishes the last page and writes the page tree, xref table and trailer
+func (p *pdfWriter) Close() error {
+	if p.page.Len() > 0 || len(p.pages) == 0 {
+		p.flushPage()
+	}
+
+	kids := make([]string, len(p.pages))
+	for i, obj := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", obj)
+	}
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+
+	xrefOffset := p.offset
+	p.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", p.nextObj))
+	for num := 1; num < p.nextObj; num++ {
+		p.write(fmt.Sprintf("%010d 00000 n \n", p.offsets[num]))
+	}
+	p.write(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.nextObj, xrefOffset))
+	return p.err
+}
+
+// wrapLine splits a line into pieces of at most maxChars characters at word boundaries
+func wrapLine(line string, maxChars int) []string {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	current := ""
+	for _, word := range words {
+		// Hard-break words that are longer than a whole line
+		for utf8.RuneCountInString(word) > maxChars {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:maxChars]))
+			word = string(runes[maxChars:])
+		}
+		if current == "" {
+			current = word
+		} else if utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= maxChars {
+			current += " " + word
+		} else {
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	return append(lines, current)
+}
+
+// pdfString encodes text as a WinAnsi PDF string literal body. Latin-1 covers
+// Norwegian letters; other characters are replaced with "?".
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '\t':
+			b.WriteString("    ")
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/model"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Language used when a prompt has no text in the requested language
+const defaultPromptLanguage = "en"
+
+// Prompt is a daily writing prompt with its text in one or more languages
+type Prompt struct {
+	ID   string            `json:"id"`
+	Text map[string]string `json:"text"` // language code -> prompt text
+}
+
+var (
+	promptMutex sync.RWMutex
+	prompts     = []Prompt{
+		{ID: "grateful", Text: map[string]string{
+			"en": "What are three things you are grateful for today?",
+			"nb": "Hvilke tre ting er du takknemlig for i dag?",
+		}},
+		{ID: "small-win", Text: map[string]string{
+			"en": "Describe a small win from today, however minor it seems.",
+			"nb": "Beskriv en liten seier fra i dag, uansett hvor liten den virker.",
+		}},
+		{ID: "learned", Text: map[string]string{
+			"en": "What did you learn today that you didn't know yesterday?",
+			"nb": "Hva lærte du i dag som du ikke visste i går?",
+		}},
+		{ID: "energy", Text: map[string]string{
+			"en": "What gave you energy today, and what drained it?",
+			"nb": "Hva ga deg energi i dag, og hva tappet deg for energi?",
+		}},
+		{ID: "conversation", Text: map[string]string{
+			"en": "Write about a conversation that stayed with you.",
+			"nb": "Skriv om en samtale som har satt spor i deg.",
+		}},
+		{ID: "tomorrow", Text: map[string]string{
+			"en": "What is one thing you want to do differently tomorrow?",
+			"nb": "Hva er én ting du vil gjøre annerledes i morgen?",
+		}},
+		{ID: "place", Text: map[string]string{
+			"en": "Describe a place you were today using all five senses.",
+			"nb": "Beskriv et sted du var i dag med alle fem sansene.",
+		}},
+		{ID: "worry", Text: map[string]string{
+			"en": "What is on your mind right now? Write it down and let it go.",
+			"nb": "Hva har du på hjertet akkurat nå? Skriv det ned og gi slipp.",
+		}},
+		{ID: "kindness", Text: map[string]string{
+			"en": "Who was kind to you recently, or who were you kind to?",
+			"nb": "Hvem var snill mot deg nylig, eller hvem var du snill mot?",
+		}},
+		{ID: "future-self", Text: map[string]string{
+			"en": "Write a short note to yourself one year from now.",
+			"nb": "Skriv en kort hilsen til deg selv om ett år.",
+		}},
+		{ID: "proud", Text: map[string]string{
+			"en": "What are you proud of this week?",
+			"nb": "Hva er du stolt av denne uken?",
+		}},
+		{ID: "outside", Text: map[string]string{
+			"en": "What did you notice outside today: the weather, the light, the people?",
+			"nb": "Hva la du merke til ute i dag: været, lyset, menneskene?",
+		}},
+	}
+)
+
+// RegisterPrompts adds prompts to the catalog. Prompts with an existing ID replace it.
+func RegisterPrompts(extra ...Prompt) {
+	promptMutex.Lock()
+	defer promptMutex.Unlock()
+
+	for _, p := range extra {
+		replaced := false
+		for i := range prompts {
+			if prompts[i].ID == p.ID {
+				prompts[i] = p
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			prompts = append(prompts, p)
+		}
+	}
+}
+
+// LoadPromptsFromFile registers extra prompts from the JSON file named by
+// JOURNAL_PROMPTS_FILE, if set. The file holds an array of {"id", "text": {"en": ...}}.
+func LoadPromptsFromFile() {
+	path := os.Getenv("JOURNAL_PROMPTS_FILE")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read journal prompts file: %v", err)
+		return
+	}
+	var extra []Prompt
+	if err := json.Unmarshal(data, &extra); err != nil {
+		log.Printf("Failed to parse journal prompts file: %v", err)
+		return
+	}
+	RegisterPrompts(extra...)
+	log.Printf("Loaded %d journal prompts from %s", len(extra), path)
+}
+
+// PromptForDate picks the prompt for a given day. Every user sees the same prompt on
+// the same date, and the order is shuffled so consecutive days don't follow the catalog.
+func PromptForDate(date string) Prompt {
+	promptMutex.RLock()
+	defer promptMutex.RUnlock()
+
+	h := fnv.New32a()
+	h.Write([]byte(date))
+	return prompts[h.Sum32()%uint32(len(prompts))]
+}
+
+// Localized returns the prompt text in lang, falling back to English
+func (p Prompt) Localized(lang string) (string, string) {
+	if text, ok := p.Text[lang]; ok {
+		return text, lang
+	}
+	return p.Text[defaultPromptLanguage], defaultPromptLanguage
+}
+
+// promptLanguage picks the language from the lang parameter or the Accept-Language header.
+// Norwegian variants (no, nn) map to Bokmål (nb).
+func promptLanguage(r *http.Request) string {
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = r.Header.Get("Accept-Language")
+	}
+	return normalizeLanguage(lang)
+}
+
+func normalizeLanguage(lang string) string {
+	// Take the first tag of an Accept-Language list, e.g. "nb-NO,nb;q=0.9,en;q=0.8"
+	lang = strings.ToLower(strings.TrimSpace(strings.Split(lang, ",")[0]))
+	lang = strings.Split(strings.Split(lang, ";")[0], "-")[0]
+	switch lang {
+	case "no", "nn":
+		return "nb"
+	case "":
+		return defaultPromptLanguage
+	}
+	return lang
+}
+
+// userToday returns today's date for the user, in the time zone saved with their reminder
+func userToday(userID string, now time.Time) string {
+	var user struct{ JournalReminder model.JournalReminder }
+	doc, err := db.Client.Collection("users").Doc(userID).Get(db.Ctx)
+	if err == nil {
+		err = doc.DataTo(&user)
+	}
+	if err != nil {
+		log.Printf("Failed to load the time zone of %s: %v", userID, err)
+	}
+	return localDate(user.JournalReminder, now)
+}
+
+// GetJournalPromptHandler returns the writing prompt of the day.
+// Query parameters: lang (optional, defaults to Accept-Language) and date (optional, YYYY-MM-DD,
+// defaults to today in the user's time zone).
+func GetJournalPromptHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = userToday(userID, time.Now())
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidDate, "Invalid date format. Please use YYYY-MM-DD.")
+		return
+	}
+
+	prompt := PromptForDate(date)
+	text, lang := prompt.Localized(promptLanguage(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":   prompt.ID,
+		"date": date,
+		"lang": lang,
+		"text": text,
+	})
+}
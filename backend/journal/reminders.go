@@ -0,0 +1,227 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/email"
+	"backend/function"
+	"backend/model"
+	"backend/validation"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// errReminderNotDue aborts the claim transaction when there is nothing to send
+var errReminderNotDue = errors.New("reminder not due")
+
+// GetReminderHandler returns the logged-in user's reminder setting
+func GetReminderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	doc, err := db.Client.Collection("users").Doc(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to get reminder")
+		return
+	}
+
+	var user struct{ JournalReminder model.JournalReminder }
+	if err := doc.DataTo(&user); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse reminder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.JournalReminder)
+}
+
+// UpdateReminderHandler turns the daily reminder on or off and sets when it is sent
+func UpdateReminderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var reminder model.JournalReminder
+	if !validation.DecodeJSON(w, r, &reminder) {
+		return
+	}
+
+	if reminder.Enabled {
+		at, err := time.Parse("15:04", reminder.Time)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidTime, "Invalid time format. Please use HH:MM.")
+			return
+		}
+		reminder.Time = at.Format("15:04")
+		if _, err := time.LoadLocation(reminder.TimeZone); err != nil || reminder.TimeZone == "" {
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidTimeZone, "Invalid time zone")
+			return
+		}
+	}
+	reminder.Language = normalizeLanguage(reminder.Language)
+
+	// Keep LastSent so re-saving the setting doesn't send a second reminder today
+	_, err := db.Client.Collection("users").Doc(userID).Update(db.Ctx, []firestore.Update{
+		{Path: "JournalReminder.Enabled", Value: reminder.Enabled},
+		{Path: "JournalReminder.Time", Value: reminder.Time},
+		{Path: "JournalReminder.TimeZone", Value: reminder.TimeZone},
+		{Path: "JournalReminder.Language", Value: reminder.Language},
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update reminder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Reminder updated successfully"})
+}
+
+// SendDueReminders emails every user whose reminder time has passed today (in their own
+// time zone) and who hasn't written a journal entry for today yet
+func SendDueReminders() {
+	iter := db.Client.Collection("users").Where("JournalReminder.Enabled", "==", true).Documents(db.Ctx)
+	defer iter.Stop()
+
+	var sent int
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating reminder users: %v", err)
+			return
+		}
+
+		// Most users aren't due; only those who are get the claim transaction
+		now := time.Now()
+		var user struct{ JournalReminder model.JournalReminder }
+		if err := doc.DataTo(&user); err != nil {
+			log.Printf("Failed to parse reminder of %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if dueDate(user.JournalReminder, now) == "" {
+			continue
+		}
+
+		ok, err := sendReminderIfDue(doc.Ref, now)
+		if err != nil {
+			log.Printf("Failed to send journal reminder to %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("Sent %d journal reminders.", sent)
+	}
+}
+
+// dueDate returns the user's local date if the reminder is due at now, or "" if it is
+// off, already sent today or set for later in the day. Times are compared as minutes
+// since midnight, so settings saved unpadded ("9:05") work too.
+func dueDate(reminder model.JournalReminder, now time.Time) string {
+	if !reminder.Enabled {
+		return ""
+	}
+	loc, err := time.LoadLocation(reminder.TimeZone)
+	if err != nil {
+		return ""
+	}
+	at, err := time.Parse("15:04", reminder.Time)
+	if err != nil {
+		return ""
+	}
+	local := now.In(loc)
+	today := local.Format("2006-01-02")
+	if reminder.LastSent == today || local.Hour()*60+local.Minute() < at.Hour()*60+at.Minute() {
+		return ""
+	}
+	return today
+}
+
+// localDate returns the date at now in the reminder's time zone, or on the server's
+// clock if the user hasn't saved one
+func localDate(reminder model.JournalReminder, now time.Time) string {
+	if reminder.TimeZone != "" {
+		if loc, err := time.LoadLocation(reminder.TimeZone); err == nil {
+			now = now.In(loc)
+		}
+	}
+	return now.Format("2006-01-02")
+}
+
+// sendReminderIfDue sends one user's reminder if it is due. The day is claimed in a
+// transaction first, so several backend replicas never send the same reminder twice.
+func sendReminderIfDue(userRef *firestore.DocumentRef, now time.Time) (bool, error) {
+	var reminder model.JournalReminder
+	var today, address string
+
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user struct {
+			Email           string
+			Language        string
+			JournalReminder model.JournalReminder
+		}
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		reminder, address = user.JournalReminder, user.Email
+		if reminder.Language == "" {
+			reminder.Language = user.Language
+		}
+
+		// Checked again, since another replica may have sent it since the listing
+		if today = dueDate(reminder, now); today == "" {
+			return errReminderNotDue
+		}
+
+		// Nothing to remind about if the user already wrote today
+		written, err := tx.Documents(userRef.Collection("journals").Where("Date", "==", today).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		if err := tx.Update(userRef, []firestore.Update{{Path: "JournalReminder.LastSent", Value: today}}); err != nil {
+			return err
+		}
+		if len(written) > 0 {
+			today = ""
+		}
+		return nil
+	})
+	if err == errReminderNotDue {
+		return false, nil
+	}
+	if err != nil || today == "" {
+		return false, err
+	}
+
+	// The prompt and the email share a language, unless the prompt has one emails lack
+	text, lang := PromptForDate(today).Localized(normalizeLanguage(reminder.Language))
+	err = email.Send(address, lang, "journal_reminder", map[string]interface{}{
+		"Prompt": text,
+		"Link":   function.AppURL("/journal"),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,65 @@
+package journal
+
+import (
+	"backend/model"
+	"testing"
+	"time"
+)
+
+func TestDueDate(t *testing.T) {
+	// 23:00 in Oslo on 2024-06-01 (CEST, UTC+2)
+	now := time.Date(2024, 6, 1, 21, 0, 0, 0, time.UTC)
+	reminder := func(at, lastSent string) model.JournalReminder {
+		return model.JournalReminder{Enabled: true, Time: at, TimeZone: "Europe/Oslo", LastSent: lastSent}
+	}
+
+	tests := []struct {
+		name     string
+		reminder model.JournalReminder
+		want     string
+	}{
+		{name: "time passed", reminder: reminder("21:30", ""), want: "2024-06-01"},
+		{name: "exactly now", reminder: reminder("23:00", ""), want: "2024-06-01"},
+		{name: "unpadded time passed", reminder: reminder("9:05", ""), want: "2024-06-01"},
+		{name: "later today", reminder: reminder("23:30", ""), want: ""},
+		{name: "already sent today", reminder: reminder("21:30", "2024-06-01"), want: ""},
+		{name: "sent yesterday", reminder: reminder("21:30", "2024-05-31"), want: "2024-06-01"},
+		{name: "turned off", reminder: model.JournalReminder{Time: "21:30", TimeZone: "Europe/Oslo"}, want: ""},
+		{name: "bad time zone", reminder: model.JournalReminder{Enabled: true, Time: "21:30", TimeZone: "Mars/Base"}, want: ""},
+		{name: "no time", reminder: reminder("", ""), want: ""},
+		{
+			name:     "other time zone is on the next day",
+			reminder: model.JournalReminder{Enabled: true, Time: "06:00", TimeZone: "Asia/Tokyo"},
+			want:     "2024-06-02",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dueDate(tt.reminder, now); got != tt.want {
+				t.Errorf("dueDate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalDate(t *testing.T) {
+	// 23:30 UTC on 2024-06-01
+	now := time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		timeZone string
+		want     string
+	}{
+		{timeZone: "Europe/Oslo", want: "2024-06-02"},
+		{timeZone: "America/New_York", want: "2024-06-01"},
+		{timeZone: "", want: "2024-06-01"},
+		{timeZone: "Mars/Base", want: "2024-06-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timeZone, func(t *testing.T) {
+			if got := localDate(model.JournalReminder{TimeZone: tt.timeZone}, now); got != tt.want {
+				t.Errorf("localDate(%q) = %q, want %q", tt.timeZone, got, tt.want)
+			}
+		})
+	}
+}
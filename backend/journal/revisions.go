@@ -0,0 +1,271 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errJournalNotFound means there is no entry to replace
+var errJournalNotFound = errors.New("journal not found")
+
+// replaceJournal overwrites the entry at docRef with journal and keeps the version it
+// replaces as a revision. Both are written in one transaction, so concurrent saves each
+// keep the version they actually replaced. Sharing and the section number are managed by
+// their own endpoints and carried over from the stored entry. Fields are copied as
+// stored, so encrypted entries stay encrypted.
+//
+// It returns errJournalNotFound if there is no entry at docRef, and a
+// *duplicateEntriesError if journal moves a main entry to a date that already has one.
+func replaceJournal(docRef *firestore.DocumentRef, journal *model.Journal) error {
+	return db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return errJournalNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var stored model.Journal
+		if err := doc.DataTo(&stored); err != nil {
+			return err
+		}
+		journal.SharedWith, journal.Section = stored.SharedWith, stored.Section
+		if journal.Date != stored.Date {
+			if journal.Section, err = sectionOnDate(tx, docRef.Parent, journal.Date, stored.Section); err != nil {
+				return err
+			}
+		}
+
+		revisionRef, revision := newRevision(docRef, stored)
+		if err := tx.Create(revisionRef, revision); err != nil {
+			return err
+		}
+		return tx.Set(docRef, *journal)
+	})
+}
+
+// sectionOnDate returns the section number an entry moved to date gets there. A main
+// entry stays the main entry if the date has none yet; a section is added after the
+// date's other entries, or becomes the main entry of an empty date.
+func sectionOnDate(tx *firestore.Transaction, journals *firestore.CollectionRef, date string, section int) (int, error) {
+	existing, err := tx.Documents(journals.Where("Date", "==", date)).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) == 0 {
+		return 0, nil
+	}
+	if section > 0 {
+		return nextSection(existing), nil
+	}
+	for _, doc := range existing {
+		var other model.Journal
+		if err := doc.DataTo(&other); err != nil {
+			return 0, err
+		}
+		if other.Section == 0 {
+			return 0, &duplicateEntriesError{JournalIDs: []string{doc.Ref.ID}}
+		}
+	}
+	return 0, nil
+}
+
+// newRevision builds the revision document for a stored journal entry
+func newRevision(docRef *firestore.DocumentRef, current model.Journal) (*firestore.DocumentRef, model.JournalRevision) {
+	revisionRef := docRef.Collection("revisions").NewDoc()
+	return revisionRef, model.JournalRevision{
+		RevisionID: revisionRef.ID,
+		JournalID:  docRef.ID,
+		Date:       current.Date,
+		Title:      current.Title,
+		Content:    current.Content,
+		Mood:       current.Mood,
+		Tags:       current.Tags,
+		SavedAt:    time.Now(),
+	}
+}
+
+// openRevision decrypts the fields of a stored revision
+func openRevision(userID string, revision *model.JournalRevision) error {
+	journal := model.Journal{Title: revision.Title, Content: revision.Content, Tags: revision.Tags}
+	if err := openJournal(userID, &journal); err != nil {
+		return err
+	}
+	revision.Title, revision.Content, revision.Tags = journal.Title, journal.Content, journal.Tags
+	return nil
+}
+
+// loadRevision fetches and decrypts a single revision. The revision "current"
+// refers to the entry as it is stored right now.
+func loadRevision(userID string, docRef *firestore.DocumentRef, revisionID string) (*model.JournalRevision, error) {
+	var revision model.JournalRevision
+	if revisionID == "current" {
+		doc, err := docRef.Get(db.Ctx)
+		if err != nil {
+			return nil, err
+		}
+		var journal model.Journal
+		if err := doc.DataTo(&journal); err != nil {
+			return nil, err
+		}
+		revision = model.JournalRevision{
+			RevisionID: "current",
+			JournalID:  docRef.ID,
+			Date:       journal.Date,
+			Title:      journal.Title,
+			Content:    journal.Content,
+			Mood:       journal.Mood,
+			Tags:       journal.Tags,
+			SavedAt:    doc.UpdateTime,
+		}
+	} else {
+		doc, err := docRef.Collection("revisions").Doc(revisionID).Get(db.Ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := doc.DataTo(&revision); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := openRevision(userID, &revision); err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetJournalRevisionsHandler lists earlier versions of a journal entry, newest first
+func GetJournalRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	journalID := r.URL.Query().Get("journalID")
+	if journalID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID parameter")
+		return
+	}
+
+	docRef := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID)
+	docs, err := docRef.Collection("revisions").OrderBy("SavedAt", firestore.Desc).Documents(db.Ctx).GetAll()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve revisions")
+		return
+	}
+
+	revisions := []model.JournalRevision{}
+	for _, doc := range docs {
+		var revision model.JournalRevision
+		if err := doc.DataTo(&revision); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse revision data")
+			return
+		}
+		if err := openRevision(userID, &revision); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decrypt revision")
+			return
+		}
+		revisions = append(revisions, revision)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// DiffJournalRevisionsHandler compares two versions of a journal entry.
+// Query parameters: journalID, from and to (revision IDs, or "current").
+func DiffJournalRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	journalID := r.URL.Query().Get("journalID")
+	fromID := r.URL.Query().Get("from")
+	toID := r.URL.Query().Get("to")
+	if toID == "" {
+		toID = "current"
+	}
+	if journalID == "" || fromID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID or from parameter")
+		return
+	}
+
+	docRef := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID)
+	from, err := loadRevision(userID, docRef, fromID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.RevisionNotFound, "Revision not found")
+		return
+	}
+	to, err := loadRevision(userID, docRef, toID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.RevisionNotFound, "Revision not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from.RevisionID,
+		"to":      to.RevisionID,
+		"changes": diffText(from.Content, to.Content),
+	})
+}
+
+// RestoreJournalRevisionHandler replaces a journal entry with one of its earlier versions.
+// The version being replaced is kept as a new revision, so a restore can itself be undone.
+func RestoreJournalRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	journalID := r.URL.Query().Get("journalID")
+	revisionID := r.URL.Query().Get("revisionID")
+	if journalID == "" || revisionID == "" || revisionID == "current" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID or revisionID parameter")
+		return
+	}
+
+	docRef := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID)
+	revision, err := loadRevision(userID, docRef, revisionID)
+	if err != nil {
+		apierror.Write(w, http.StatusNotFound, apierror.RevisionNotFound, "Revision not found")
+		return
+	}
+
+	journal := model.Journal{
+		JournalID: journalID,
+		Date:      revision.Date,
+		Title:     revision.Title,
+		Content:   revision.Content,
+		Mood:      revision.Mood,
+		Tags:      revision.Tags,
+		UserID:    userID,
+	}
+	if err := sealJournal(userID, &journal); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encrypt journal")
+		return
+	}
+	if !writeReplaceError(w, replaceJournal(docRef, &journal), "Failed to restore journal") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Journal restored successfully",
+	})
+}
@@ -0,0 +1,56 @@
+package journal
+
+import (
+	"backend/encryption"
+	"backend/markdown"
+	"backend/model"
+	"strings"
+)
+
+// sealJournal builds the search index for a journal entry and encrypts its title,
+// content and tags with the owner's data key before it is written to Firestore
+func sealJournal(userID string, journal *model.Journal) error {
+	key, err := encryption.UserKey(userID)
+	if err != nil {
+		return err
+	}
+
+	indexed := journal.Title + "\n" + journal.Content + "\n" + strings.Join(journal.Tags, " ")
+	journal.SearchTokens = encryption.BlindIndex(key, Tokenize(indexed))
+
+	if journal.Title, err = encryption.Encrypt(key, journal.Title); err != nil {
+		return err
+	}
+	if journal.Content, err = encryption.Encrypt(key, journal.Content); err != nil {
+		return err
+	}
+	for i, tag := range journal.Tags {
+		if journal.Tags[i], err = encryption.Encrypt(key, tag); err != nil {
+			return err
+		}
+	}
+	journal.HTML = ""
+	return nil
+}
+
+// openJournal decrypts a journal entry read from Firestore and renders its content
+func openJournal(userID string, journal *model.Journal) error {
+	key, err := encryption.UserKey(userID)
+	if err != nil {
+		return err
+	}
+
+	if journal.Title, err = encryption.Decrypt(key, journal.Title); err != nil {
+		return err
+	}
+	if journal.Content, err = encryption.Decrypt(key, journal.Content); err != nil {
+		return err
+	}
+	for i, tag := range journal.Tags {
+		if journal.Tags[i], err = encryption.Decrypt(key, tag); err != nil {
+			return err
+		}
+	}
+	journal.HTML = markdown.Render(journal.Content)
+	return nil
+}
@@ -0,0 +1,370 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/encryption"
+	"backend/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloud.google.com/go/firestore"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Number of words shown on each side of the first match in a snippet
+const snippetRadius = 8
+
+// Letters that do not decompose under NFD but should still match their plain forms
+var foldReplacer = strings.NewReplacer(
+	"æ", "ae",
+	"ø", "o",
+	"œ", "oe",
+	"ß", "ss",
+	"đ", "d",
+	"ł", "l",
+)
+
+// JournalSearchResult is a single hit returned by SearchJournalsHandler
+type JournalSearchResult struct {
+	JournalID string   `json:"journalID"`
+	Date      string   `json:"date"`
+	Title     string   `json:"title,omitempty"`
+	Mood      int      `json:"mood,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Snippet   string   `json:"snippet"`
+	Score     int      `json:"score"`
+}
+
+// normalizeWord lowercases a word and strips diacritics so "Blåbær" and "blabaer" compare equal
+func normalizeWord(word string) string {
+	word = foldReplacer.Replace(strings.ToLower(word))
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(word) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// wordSpan is a word in the original text and its byte offsets
+type wordSpan struct {
+	start, end int
+}
+
+// splitWords returns the byte spans of every letter/digit run in text
+func splitWords(text string) []wordSpan {
+	var spans []wordSpan
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			spans = append(spans, wordSpan{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, wordSpan{start, len(text)})
+	}
+	return spans
+}
+
+// Tokenize splits text into unique normalized search tokens
+func Tokenize(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, span := range splitWords(text) {
+		token := normalizeWord(text[span.start:span.end])
+		if token == "" || seen[token] {
+			continue
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// buildSnippet returns an HTML-escaped excerpt of content around the first match,
+// with every matching word wrapped in <mark>, and the number of matching words
+func buildSnippet(content string, terms map[string]bool) (string, int) {
+	spans := splitWords(content)
+
+	first := -1
+	hits := 0
+	for i, span := range spans {
+		if terms[normalizeWord(content[span.start:span.end])] {
+			if first < 0 {
+				first = i
+			}
+			hits++
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+	if len(spans) == 0 {
+		return "", 0
+	}
+
+	from := first - snippetRadius
+	if from < 0 {
+		from = 0
+	}
+	to := first + snippetRadius
+	if to >= len(spans) {
+		to = len(spans) - 1
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := spans[from].start
+	for _, span := range spans[from : to+1] {
+		b.WriteString(html.EscapeString(content[pos:span.start]))
+		word := html.EscapeString(content[span.start:span.end])
+		if terms[normalizeWord(content[span.start:span.end])] {
+			b.WriteString("<mark>" + word + "</mark>")
+		} else {
+			b.WriteString(word)
+		}
+		pos = span.end
+	}
+	if to < len(spans)-1 {
+		b.WriteString("…")
+	}
+
+	return b.String(), hits
+}
+
+// matchJournal scores a journal entry by the number of words in its content, title and
+// tags that match a search term, and builds the snippet from the first of those fields
+// with a match, so a hit in the title or tags isn't shown with unrelated text
+func matchJournal(journal model.Journal, terms map[string]bool) (string, int) {
+	var snippet string
+	score := 0
+	for _, field := range []string{journal.Content, journal.Title, strings.Join(journal.Tags, ", ")} {
+		fieldSnippet, hits := buildSnippet(field, terms)
+		if hits > 0 && score == 0 {
+			snippet = fieldSnippet
+		}
+		score += hits
+	}
+	if score == 0 {
+		snippet, _ = buildSnippet(journal.Content, terms)
+	}
+	return snippet, score
+}
+
+// sortResults puts the entries with the most matching words first, newest first among equals
+func sortResults(results []JournalSearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Date > results[j].Date
+	})
+}
+
+// SearchJournalsHandler searches the logged-in user's journal entries.
+// Query parameters: q (required), from and to (optional, YYYY-MM-DD, inclusive),
+// and the tag and mood filters accepted by GetAllJournalsHandler.
+// The entries with the most matching words come first, newest first among equals.
+func SearchJournalsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	terms := Tokenize(r.URL.Query().Get("q"))
+	if len(terms) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing search query")
+		return
+	}
+
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidDate, "Invalid date format. Please use YYYY-MM-DD.")
+			return
+		}
+	}
+
+	filter, err := parseJournalFilter(r)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+
+	termSet := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		termSet[t] = true
+	}
+
+	// The stored index holds keyed hashes of the tokens when encryption is enabled
+	key, err := encryption.UserKey(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to load journal key")
+		return
+	}
+	indexTerms := encryption.BlindIndex(key, terms)
+
+	// Firestore only allows one array-contains filter, so narrow by the first term and check the rest in memory
+	iter := db.Client.Collection("users").Doc(userID).Collection("journals").
+		Where("SearchTokens", "array-contains", indexTerms[0]).
+		Documents(db.Ctx)
+	defer iter.Stop()
+
+	results := []JournalSearchResult{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to search journals")
+			return
+		}
+
+		var journal model.Journal
+		if err := doc.DataTo(&journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse journal data")
+			return
+		}
+
+		if (from != "" && journal.Date < from) || (to != "" && journal.Date > to) {
+			continue
+		}
+		if !containsAll(journal.SearchTokens, indexTerms) {
+			continue
+		}
+		if err := openJournal(userID, &journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decrypt journal")
+			return
+		}
+		if !filter.matches(journal) {
+			continue
+		}
+
+		snippet, score := matchJournal(journal, termSet)
+		results = append(results, JournalSearchResult{
+			JournalID: doc.Ref.ID,
+			Date:      journal.Date,
+			Title:     journal.Title,
+			Mood:      journal.Mood,
+			Tags:      journal.Tags,
+			Snippet:   snippet,
+			Score:     score,
+		})
+	}
+
+	sortResults(results)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// containsAll reports whether every term is present in tokens
+func containsAll(tokens, terms []string) bool {
+	have := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		have[t] = true
+	}
+	for _, t := range terms {
+		if !have[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// errAlreadyIndexed aborts a reindex transaction when another replica got there first
+var errAlreadyIndexed = errors.New("journal already indexed")
+
+// needsReindex reports whether an entry lacks SearchTokens or is still plaintext while
+// a master key is configured
+func needsReindex(doc *firestore.DocumentSnapshot) bool {
+	_, indexed := doc.Data()["SearchTokens"]
+	content, _ := doc.Data()["Content"].(string)
+	return !indexed || (encryption.Enabled() && !encryption.IsEncrypted(content))
+}
+
+// ReindexJournals fills in SearchTokens for journal entries written before the search index existed
+// and encrypts entries still stored as plaintext once a master key is configured
+func ReindexJournals() {
+	iter := db.Client.CollectionGroup("journals").Documents(db.Ctx)
+	defer iter.Stop()
+
+	var reindexed int
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating journals for reindex: %v", err)
+			return
+		}
+
+		if !needsReindex(doc) {
+			continue
+		}
+
+		// Every replica runs this at startup while users can edit, so the entry is read
+		// again and rewritten in a transaction rather than from the listing
+		err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			if !needsReindex(current) {
+				return errAlreadyIndexed
+			}
+			var journal model.Journal
+			if err := current.DataTo(&journal); err != nil {
+				return err
+			}
+
+			// Journals live at users/{userID}/journals/{id}
+			userID := doc.Ref.Parent.Parent.ID
+			if err := openJournal(userID, &journal); err != nil {
+				return err
+			}
+			if err := sealJournal(userID, &journal); err != nil {
+				return err
+			}
+			return tx.Set(doc.Ref, journal)
+		})
+		if err == errAlreadyIndexed || status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to reindex journal %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		reindexed++
+	}
+
+	log.Printf("Journal reindex complete. Updated %d entries.", reindexed)
+}
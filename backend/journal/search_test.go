@@ -0,0 +1,66 @@
+package journal
+
+import (
+	"backend/model"
+	"testing"
+)
+
+func TestMatchJournal(t *testing.T) {
+	terms := map[string]bool{"hike": true}
+
+	tests := []struct {
+		name    string
+		journal model.Journal
+		snippet string
+		score   int
+	}{
+		{
+			name:    "content",
+			journal: model.Journal{Title: "Saturday", Content: "A long hike today"},
+			snippet: "A long <mark>hike</mark> today",
+			score:   1,
+		},
+		{
+			name:    "title only",
+			journal: model.Journal{Title: "Hike up the hill", Content: "Legs are sore"},
+			snippet: "<mark>Hike</mark> up the hill",
+			score:   1,
+		},
+		{
+			name:    "tag only",
+			journal: model.Journal{Content: "Legs are sore", Tags: []string{"outdoors", "hike"}},
+			snippet: "outdoors, <mark>hike</mark>",
+			score:   1,
+		},
+		{
+			name:    "every field counts",
+			journal: model.Journal{Title: "Hike", Content: "The hike, then another hike", Tags: []string{"hike"}},
+			snippet: "The <mark>hike</mark>, then another <mark>hike</mark>",
+			score:   4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet, score := matchJournal(tt.journal, terms)
+			if snippet != tt.snippet || score != tt.score {
+				t.Errorf("matchJournal() = %q, %d, want %q, %d", snippet, score, tt.snippet, tt.score)
+			}
+		})
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []JournalSearchResult{
+		{JournalID: "old-many", Date: "2024-01-01", Score: 3},
+		{JournalID: "new-one", Date: "2024-03-01", Score: 1},
+		{JournalID: "mid-many", Date: "2024-02-01", Score: 3},
+	}
+	sortResults(results)
+
+	want := []string{"mid-many", "old-many", "new-one"}
+	for i, id := range want {
+		if results[i].JournalID != id {
+			t.Fatalf("result %d = %s, want order %v", i, results[i].JournalID, want)
+		}
+	}
+}
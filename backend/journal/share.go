@@ -0,0 +1,203 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/model"
+	"backend/validation"
+	"encoding/json"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// SharedJournal is a journal entry as seen by a friend it was shared with
+type SharedJournal struct {
+	JournalID     string   `json:"journalID"`
+	OwnerUsername string   `json:"ownerUsername"`
+	OwnerID       string   `json:"ownerID"`
+	Date          string   `json:"date"`
+	Title         string   `json:"title,omitempty"`
+	Content       string   `json:"content"`
+	HTML          string   `json:"html"`
+	Mood          int      `json:"mood,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// areFriends reports whether ownerID has an accepted friendship with friendID
+func areFriends(ownerID, friendID string) bool {
+	doc, err := db.Client.Collection("friends").Doc(ownerID + "_" + friendID).Get(db.Ctx)
+	if err != nil || !doc.Exists() {
+		return false
+	}
+	status, _ := doc.Data()["Status"].(string)
+	return status == "accepted"
+}
+
+// canReadJournal reports whether requesterID may read the owner's journal entry.
+// Friendship is checked on every read, so removing a friend also revokes their access.
+func canReadJournal(requesterID, ownerID string, doc *firestore.DocumentSnapshot) bool {
+	if requesterID == ownerID {
+		return true
+	}
+
+	var journal model.Journal
+	if err := doc.DataTo(&journal); err != nil {
+		return false
+	}
+	for _, sharedID := range journal.SharedWith {
+		if sharedID == requesterID {
+			return areFriends(ownerID, requesterID)
+		}
+	}
+	return false
+}
+
+// userIDForUsername looks up a user's ID by username
+func userIDForUsername(username string) (string, error) {
+	doc, err := db.Client.Collection("users").Where("Username", "==", username).Limit(1).Documents(db.Ctx).Next()
+	if err != nil {
+		return "", err
+	}
+	return doc.Ref.ID, nil
+}
+
+// ShareJournalHandler shares one of the logged-in user's journal entries read-only
+// with accepted friends, given by username in the request body
+func ShareJournalHandler(w http.ResponseWriter, r *http.Request) {
+	updateSharing(w, r, true)
+}
+
+// UnshareJournalHandler revokes access to a journal entry for the given usernames,
+// or for everyone when the list is empty
+func UnshareJournalHandler(w http.ResponseWriter, r *http.Request) {
+	updateSharing(w, r, false)
+}
+
+func updateSharing(w http.ResponseWriter, r *http.Request, share bool) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	journalID := r.URL.Query().Get("journalID")
+	if journalID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing journalID parameter")
+		return
+	}
+
+	var requestBody model.UsernamesRequest
+	if !validation.DecodeJSON(w, r, &requestBody) {
+		return
+	}
+	if share && len(requestBody.Usernames) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, "No usernames to share with")
+		return
+	}
+
+	docRef := db.Client.Collection("users").Doc(userID).Collection("journals").Doc(journalID)
+	if doc, err := docRef.Get(db.Ctx); err != nil || !doc.Exists() {
+		apierror.Write(w, http.StatusNotFound, apierror.JournalNotFound, "Journal not found")
+		return
+	}
+
+	var friendIDs []interface{}
+	for _, username := range requestBody.Usernames {
+		friendID, err := userIDForUsername(username)
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "User not found: "+username)
+			return
+		}
+		if share && !areFriends(userID, friendID) {
+			apierror.Write(w, http.StatusForbidden, apierror.NotFriends, "You can only share journals with accepted friends")
+			return
+		}
+		friendIDs = append(friendIDs, friendID)
+	}
+
+	var update firestore.Update
+	switch {
+	case share:
+		update = firestore.Update{Path: "SharedWith", Value: firestore.ArrayUnion(friendIDs...)}
+	case len(friendIDs) == 0:
+		update = firestore.Update{Path: "SharedWith", Value: firestore.Delete}
+	default:
+		update = firestore.Update{Path: "SharedWith", Value: firestore.ArrayRemove(friendIDs...)}
+	}
+	if _, err := docRef.Update(db.Ctx, []firestore.Update{update}); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update sharing")
+		return
+	}
+
+	message := "Journal shared successfully"
+	if !share {
+		message = "Journal sharing revoked"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// GetSharedJournalsHandler lists journal entries that friends have shared with the logged-in user
+func GetSharedJournalsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	iter := db.Client.CollectionGroup("journals").Where("SharedWith", "array-contains", userID).Documents(db.Ctx)
+	defer iter.Stop()
+
+	usernames := make(map[string]string)
+	shared := []SharedJournal{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve shared journals")
+			return
+		}
+
+		// Journals live at users/{userID}/journals/{id}
+		ownerID := doc.Ref.Parent.Parent.ID
+		if _, known := usernames[ownerID]; !known {
+			if !areFriends(ownerID, userID) {
+				usernames[ownerID] = ""
+			} else if ownerDoc, err := db.Client.Collection("users").Doc(ownerID).Get(db.Ctx); err == nil {
+				usernames[ownerID], _ = ownerDoc.Data()["Username"].(string)
+			}
+		}
+		if usernames[ownerID] == "" {
+			continue
+		}
+
+		var journal model.Journal
+		if err := doc.DataTo(&journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse journal data")
+			return
+		}
+		if err := openJournal(ownerID, &journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decrypt journal")
+			return
+		}
+
+		shared = append(shared, SharedJournal{
+			JournalID:     doc.Ref.ID,
+			OwnerUsername: usernames[ownerID],
+			OwnerID:       ownerID,
+			Date:          journal.Date,
+			Title:         journal.Title,
+			Content:       journal.Content,
+			HTML:          journal.HTML,
+			Mood:          journal.Mood,
+			Tags:          journal.Tags,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shared)
+}
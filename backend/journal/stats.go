@@ -0,0 +1,175 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/model"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PeriodStats summarizes the journal entries written in one week or month
+type PeriodStats struct {
+	Period      string   `json:"period"` // "2024-W45" for weeks, "2024-11" for months
+	Entries     int      `json:"entries"`
+	Words       int      `json:"words"`
+	AverageMood *float64 `json:"averageMood,omitempty"` // nil when no entry in the period has a mood
+	moodSum     int
+	moodCount   int
+}
+
+// JournalStats is the response of GetJournalStatsHandler
+type JournalStats struct {
+	TotalEntries  int           `json:"totalEntries"`
+	TotalWords    int           `json:"totalWords"`
+	DaysWritten   int           `json:"daysWritten"`
+	CurrentStreak int           `json:"currentStreak"`
+	LongestStreak int           `json:"longestStreak"`
+	LastEntryDate string        `json:"lastEntryDate,omitempty"`
+	AverageMood   *float64      `json:"averageMood,omitempty"`
+	Weekly        []PeriodStats `json:"weekly"`
+	Monthly       []PeriodStats `json:"monthly"`
+}
+
+// GetJournalStatsHandler computes writing streaks, entry and word counts per week
+// and month, and mood trends from the logged-in user's journal entries.
+// The optional tz query parameter (IANA name, e.g. Europe/Oslo) decides what "today" is.
+func GetJournalStatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	location := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidTimeZone, "Invalid time zone")
+			return
+		}
+		location = loc
+	}
+
+	journals, err := ListJournals(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve journals")
+		return
+	}
+
+	stats := computeJournalStats(journals, time.Now().In(location))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// computeJournalStats aggregates journal entries relative to the given current time
+func computeJournalStats(journals []model.Journal, now time.Time) JournalStats {
+	stats := JournalStats{Weekly: []PeriodStats{}, Monthly: []PeriodStats{}}
+
+	weekly := make(map[string]*PeriodStats)
+	monthly := make(map[string]*PeriodStats)
+	days := make(map[string]bool)
+	var moodSum, moodCount int
+
+	for _, journal := range journals {
+		date, err := time.Parse("2006-01-02", journal.Date)
+		if err != nil {
+			continue
+		}
+		words := len(strings.Fields(journal.Content))
+
+		stats.TotalEntries++
+		stats.TotalWords += words
+		days[journal.Date] = true
+		if journal.Mood != 0 {
+			moodSum += journal.Mood
+			moodCount++
+		}
+
+		year, week := date.ISOWeek()
+		addToPeriod(weekly, fmt.Sprintf("%d-W%02d", year, week), words, journal.Mood)
+		addToPeriod(monthly, date.Format("2006-01"), words, journal.Mood)
+	}
+
+	stats.DaysWritten = len(days)
+	stats.AverageMood = average(moodSum, moodCount)
+	stats.Weekly = sortedPeriods(weekly)
+	stats.Monthly = sortedPeriods(monthly)
+
+	// Walk the distinct dates in order to find the longest run of consecutive days
+	dates := make([]string, 0, len(days))
+	for d := range days {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	run := 0
+	var previous time.Time
+	for i, d := range dates {
+		date, _ := time.Parse("2006-01-02", d)
+		if i > 0 && date.Sub(previous) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > stats.LongestStreak {
+			stats.LongestStreak = run
+		}
+		previous = date
+	}
+	if len(dates) > 0 {
+		stats.LastEntryDate = dates[len(dates)-1]
+	}
+
+	// The current streak stays alive until the end of today, so it may end yesterday
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := today
+	if !days[day.Format("2006-01-02")] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for days[day.Format("2006-01-02")] {
+		stats.CurrentStreak++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return stats
+}
+
+func addToPeriod(periods map[string]*PeriodStats, key string, words, mood int) {
+	p, ok := periods[key]
+	if !ok {
+		p = &PeriodStats{Period: key}
+		periods[key] = p
+	}
+	p.Entries++
+	p.Words += words
+	if mood != 0 {
+		p.moodSum += mood
+		p.moodCount++
+	}
+}
+
+// sortedPeriods returns the periods in chronological order with their average mood filled in
+func sortedPeriods(periods map[string]*PeriodStats) []PeriodStats {
+	result := make([]PeriodStats, 0, len(periods))
+	for _, p := range periods {
+		p.AverageMood = average(p.moodSum, p.moodCount)
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Period < result[j].Period
+	})
+	return result
+}
+
+func average(sum, count int) *float64 {
+	if count == 0 {
+		return nil
+	}
+	avg := float64(sum) / float64(count)
+	return &avg
+}
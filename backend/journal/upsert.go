@@ -0,0 +1,246 @@
+package journal
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/model"
+	"backend/validation"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+var (
+	// errVersionMismatch means the entry changed since the client read it (If-Match failed)
+	errVersionMismatch = errors.New("journal entry was changed by another request")
+	// errNoEntryForDate means If-Match named a version but there is nothing to update
+	errNoEntryForDate = errors.New("no journal entry for this date")
+)
+
+// duplicateEntriesError means several main entries exist for one date, which older
+// versions of the app allowed. The client has to delete or merge them first.
+type duplicateEntriesError struct {
+	JournalIDs []string
+}
+
+func (e *duplicateEntriesError) Error() string {
+	return "multiple journal entries exist for this date"
+}
+
+// DatedJournal is a journal entry together with the version clients send back in If-Match
+type DatedJournal struct {
+	model.Journal
+	Version string `json:"version"`
+}
+
+// journalDate reads and validates the {date} path value
+func journalDate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	date, err := time.Parse("2006-01-02", r.PathValue("date"))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidDate, "Invalid date format. Please use YYYY-MM-DD.")
+		return "", false
+	}
+	return date.Format("2006-01-02"), true
+}
+
+// journalVersion identifies the stored state of an entry for optimistic concurrency
+func journalVersion(doc *firestore.DocumentSnapshot) string {
+	return strconv.FormatInt(doc.UpdateTime.UnixNano(), 10)
+}
+
+// GetJournalByDateHandler returns the logged-in user's entry for {date} followed by its sections
+func GetJournalByDateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+	date, ok := journalDate(w, r)
+	if !ok {
+		return
+	}
+
+	docs, err := db.Client.Collection("users").Doc(userID).Collection("journals").
+		Where("Date", "==", date).Documents(db.Ctx).GetAll()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve journals")
+		return
+	}
+
+	entries := []DatedJournal{}
+	for _, doc := range docs {
+		var journal model.Journal
+		if err := doc.DataTo(&journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse journal data")
+			return
+		}
+		if err := openJournal(userID, &journal); err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decrypt journal")
+			return
+		}
+		journal.JournalID = doc.Ref.ID
+		entries = append(entries, DatedJournal{Journal: journal, Version: journalVersion(doc)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Section < entries[j].Section
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"date":    date,
+		"entries": entries,
+	})
+}
+
+// UpsertJournalByDateHandler creates or replaces the logged-in user's entry for {date}.
+//
+// Conflict policy: without an If-Match header the last write wins (the replaced
+// version is kept as a revision). With If-Match set to the version from
+// GetJournalByDateHandler the write only succeeds if nobody changed the entry in the
+// meantime, otherwise 412 is returned. If the date holds several main entries from
+// before this endpoint existed, 409 lists them so the client can resolve the duplicates.
+// The section query parameter targets an extra section instead of the main entry.
+func UpsertJournalByDateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+	date, ok := journalDate(w, r)
+	if !ok {
+		return
+	}
+
+	section := 0
+	if value := r.URL.Query().Get("section"); value != "" {
+		var err error
+		if section, err = strconv.Atoi(value); err != nil || section < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidRequest, "Invalid section")
+			return
+		}
+	}
+
+	var journal model.Journal
+	if !validation.DecodeJSON(w, r, &journal) {
+		return
+	}
+	journal.Date = date
+	journal.UserID = userID
+	journal.Section = section
+	journal.SharedWith = nil
+	if err := validateJournal(&journal); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+	if err := sealJournal(userID, &journal); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encrypt journal")
+		return
+	}
+
+	ifMatch := strings.Trim(r.Header.Get("If-Match"), `"`)
+	journals := db.Client.Collection("users").Doc(userID).Collection("journals")
+
+	var created bool
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(journals.Where("Date", "==", date)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		var matching []*firestore.DocumentSnapshot
+		for _, doc := range docs {
+			var stored model.Journal
+			if err := doc.DataTo(&stored); err != nil {
+				return err
+			}
+			if stored.Section == section {
+				matching = append(matching, doc)
+			}
+		}
+
+		switch len(matching) {
+		case 0:
+			if ifMatch != "" {
+				return errNoEntryForDate
+			}
+			docRef := journals.NewDoc()
+			journal.JournalID = docRef.ID
+			created = true
+			return tx.Create(docRef, journal)
+
+		case 1:
+			doc := matching[0]
+			if ifMatch != "" && ifMatch != "*" && ifMatch != journalVersion(doc) {
+				return errVersionMismatch
+			}
+
+			var stored model.Journal
+			if err := doc.DataTo(&stored); err != nil {
+				return err
+			}
+			revisionRef, revision := newRevision(doc.Ref, stored)
+			if err := tx.Create(revisionRef, revision); err != nil {
+				return err
+			}
+
+			journal.JournalID = doc.Ref.ID
+			journal.SharedWith = stored.SharedWith
+			created = false
+			return tx.Set(doc.Ref, journal)
+
+		default:
+			ids := make([]string, len(matching))
+			for i, doc := range matching {
+				ids[i] = doc.Ref.ID
+			}
+			return &duplicateEntriesError{JournalIDs: ids}
+		}
+	})
+
+	var duplicates *duplicateEntriesError
+	switch {
+	case errors.As(err, &duplicates):
+		apierror.WriteError(w, http.StatusConflict, &apierror.Error{
+			Code:    apierror.DuplicateJournals,
+			Message: "Multiple journal entries exist for this date. Delete or merge them first.",
+			Meta:    map[string]interface{}{"journalIDs": duplicates.JournalIDs},
+		})
+		return
+	case errors.Is(err, errVersionMismatch), errors.Is(err, errNoEntryForDate):
+		apierror.Write(w, http.StatusPreconditionFailed, apierror.VersionMismatch, err.Error())
+		return
+	case err != nil:
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to save journal")
+		return
+	}
+
+	message := "Journal updated successfully"
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		message = "Journal created successfully"
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":   message,
+		"journalID": journal.JournalID,
+	})
+}
+
+// nextSection returns the section number for a new extra section on a date
+func nextSection(docs []*firestore.DocumentSnapshot) int {
+	next := 1
+	for _, doc := range docs {
+		var stored model.Journal
+		if err := doc.DataTo(&stored); err == nil && stored.Section >= next {
+			next = stored.Section + 1
+		}
+	}
+	return next
+}
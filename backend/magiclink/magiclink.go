@@ -0,0 +1,189 @@
+// Package magiclink makes the links sent by email that verify an address, reset a
+// password or log in without one. A link carries a token naming the user, the purpose
+// and an expiry, signed with HMAC-SHA256. Only the newest link per purpose works, and
+// only once: its ID is kept under the user's MagicLinks field until it is used.
+//
+// Links point to the app at APP_URL, which posts the token back to the API.
+package magiclink
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/function"
+	"backend/identity"
+	"backend/model"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Purpose says what a link does
+type Purpose string
+
+const (
+	VerifyEmail   Purpose = "verify_email"
+	PasswordReset Purpose = "password_reset"
+	Login         Purpose = "login"
+)
+
+var (
+	// ErrInvalid is returned for a link that is malformed, forged, used, replaced by a
+	// newer one or meant for another purpose
+	ErrInvalid = errors.New("invalid link")
+
+	// ErrExpired is returned for a link past its expiry
+	ErrExpired = errors.New("link has expired")
+)
+
+var encoding = base64.RawURLEncoding
+
+// payload is the signed part of a token
+type payload struct {
+	UserID  string  `json:"uid"`
+	Purpose Purpose `json:"pur"`
+	ID      string  `json:"jti"`
+	Expires int64   `json:"exp"`
+}
+
+// secret signs the tokens. It falls back to the JWT key so links work without extra setup.
+func secret() []byte {
+	if key := os.Getenv("MAGIC_LINK_SECRET"); key != "" {
+		return []byte(key)
+	}
+	return []byte(os.Getenv("JWT_SECRET_KEY"))
+}
+
+// Field returns the path of the user document field holding the ID of the newest link
+// for purpose
+func Field(purpose Purpose) string {
+	return "MagicLinks." + string(purpose)
+}
+
+// New makes a link for the user valid for lifetime and returns its URL and ID. The ID is
+// stored at Field(purpose) and the URL is sent to the user.
+func New(userID string, purpose Purpose, lifetime time.Duration) (string, string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	p := payload{
+		UserID:  userID,
+		Purpose: purpose,
+		ID:      encoding.EncodeToString(random),
+		Expires: time.Now().Add(lifetime).Unix(),
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return "", "", err
+	}
+	body := encoding.EncodeToString(raw)
+	token := body + "." + encoding.EncodeToString(sign(body))
+	return linkURL(purpose, token), p.ID, nil
+}
+
+// Issue makes a link for purpose and stores it on the user, replacing any earlier one
+func Issue(userRef *firestore.DocumentRef, purpose Purpose, lifetime time.Duration) (string, error) {
+	link, id, err := New(userRef.ID, purpose, lifetime)
+	if err != nil {
+		return "", err
+	}
+	_, err = userRef.Update(db.Ctx, []firestore.Update{{Path: Field(purpose), Value: id}})
+	return link, err
+}
+
+// Consume checks a token for purpose and uses it up, returning the user it was made for
+func Consume(token string, purpose Purpose) (string, error) {
+	p, err := parse(token, purpose, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	userRef := identity.UserRef(p.UserID)
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrInvalid
+		}
+		if err != nil {
+			return err
+		}
+		var user model.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if stored := user.MagicLinks[string(purpose)]; stored == "" || !hmac.Equal([]byte(stored), []byte(p.ID)) {
+			return ErrInvalid
+		}
+		return tx.Update(userRef, []firestore.Update{{Path: Field(purpose), Value: firestore.Delete}})
+	})
+	if err != nil {
+		return "", err
+	}
+	return p.UserID, nil
+}
+
+// parse checks a token's signature, purpose and expiry and returns its payload
+func parse(token string, purpose Purpose, now time.Time) (payload, error) {
+	body, signature, found := strings.Cut(token, ".")
+	if !found {
+		return payload{}, ErrInvalid
+	}
+	mac, err := encoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(body)) {
+		return payload{}, ErrInvalid
+	}
+	raw, err := encoding.DecodeString(body)
+	if err != nil {
+		return payload{}, ErrInvalid
+	}
+	var p payload
+	if err := json.Unmarshal(raw, &p); err != nil || p.Purpose != purpose || p.UserID == "" {
+		return payload{}, ErrInvalid
+	}
+	if now.Unix() > p.Expires {
+		return payload{}, ErrExpired
+	}
+	return p, nil
+}
+
+// Check runs Consume and writes the error response if the link isn't accepted
+func Check(w http.ResponseWriter, token string, purpose Purpose) (string, bool) {
+	userID, err := Consume(token, purpose)
+	switch {
+	case err == nil:
+		return userID, true
+	case errors.Is(err, ErrInvalid):
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidLink, "This link is invalid or has already been used")
+	case errors.Is(err, ErrExpired):
+		apierror.Write(w, http.StatusBadRequest, apierror.LinkExpired, "This link has expired")
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check link")
+	}
+	return "", false
+}
+
+func sign(body string) []byte {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+// linkURL returns the app page that handles links for purpose, e.g.
+// http://localhost:3000/links/login?token=...
+func linkURL(purpose Purpose, token string) string {
+	page := strings.ReplaceAll(string(purpose), "_", "-")
+	return function.AppURL("/links/" + page + "?token=" + url.QueryEscape(token))
+}
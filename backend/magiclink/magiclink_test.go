@@ -0,0 +1,76 @@
+package magiclink
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// token makes a link and returns the token in it
+func token(t *testing.T, userID string, purpose Purpose, lifetime time.Duration) (string, string) {
+	t.Helper()
+	link, id, err := New(userID, purpose, lifetime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token"), id
+}
+
+func TestNewLink(t *testing.T) {
+	t.Setenv("APP_URL", "https://dailyverse.example/")
+	link, _, err := New("user-1", PasswordReset, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, "https://dailyverse.example/links/password-reset?token=") {
+		t.Errorf("New() link = %q", link)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("MAGIC_LINK_SECRET", "test secret")
+	now := time.Now()
+	valid, id := token(t, "user-1", Login, 15*time.Minute)
+	expired, _ := token(t, "user-1", Login, -time.Minute)
+	body, signature, _ := strings.Cut(valid, ".")
+	otherBody, _, _ := strings.Cut(expired, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose Purpose
+		want    error
+	}{
+		{name: "valid", token: valid, purpose: Login},
+		{name: "other purpose", token: valid, purpose: PasswordReset, want: ErrInvalid},
+		{name: "expired", token: expired, purpose: Login, want: ErrExpired},
+		{name: "body swapped", token: otherBody + "." + signature, purpose: Login, want: ErrInvalid},
+		{name: "signature cut", token: body + "." + signature[:len(signature)-2], purpose: Login, want: ErrInvalid},
+		{name: "no signature", token: body, purpose: Login, want: ErrInvalid},
+		{name: "not base64", token: "!!!.???", purpose: Login, want: ErrInvalid},
+		{name: "empty", token: "", purpose: Login, want: ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parse(tt.token, tt.purpose, now)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("parse() error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && (p.UserID != "user-1" || p.ID != id) {
+				t.Errorf("parse() = %+v, want user-1 with ID %s", p, id)
+			}
+		})
+	}
+
+	// A token signed with another secret is rejected
+	t.Setenv("MAGIC_LINK_SECRET", "another secret")
+	if _, err := parse(valid, Login, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("parse() with another secret error = %v, want ErrInvalid", err)
+	}
+}
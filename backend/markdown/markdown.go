@@ -0,0 +1,166 @@
+// Package markdown renders a small, safe subset of Markdown to HTML.
+//
+// All text is HTML-escaped before any markup is added, and only a fixed set of
+// tags is ever emitted, so the output can be inserted into a page without
+// further sanitizing. Supported syntax: headings, paragraphs, emphasis, inline
+// code, fenced code blocks, block quotes, ordered and unordered lists, links
+// (http, https and mailto only) and horizontal rules.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	unorderedPattern   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	rulePattern        = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	codeSpanPattern    = regexp.MustCompile("`([^`]+)`")
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongPattern      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	emphasisPattern    = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	placeholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// Render converts Markdown source to sanitized HTML
+func Render(source string) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	listTag := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushParagraph()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+			out.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>\n")
+
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+
+		case rulePattern.MatchString(line):
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			tag := "h" + string(rune('0'+len(m[1])))
+			out.WriteString("<" + tag + ">" + renderInline(m[2]) + "</" + tag + ">\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			out.WriteString("<blockquote>\n" + Render(strings.Join(quote, "\n")) + "</blockquote>\n")
+
+		case unorderedPattern.MatchString(line):
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + renderInline(unorderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+
+		case orderedPattern.MatchString(line):
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + renderInline(orderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+
+		default:
+			closeList()
+			paragraph = append(paragraph, renderInline(trimmed))
+		}
+	}
+	flushParagraph()
+	closeList()
+
+	return out.String()
+}
+
+// renderInline escapes a line of text and applies inline formatting
+func renderInline(text string) string {
+	// Code spans and links are swapped for placeholders first so emphasis
+	// markers inside them are left alone
+	var held []string
+	hold := func(s string) string {
+		held = append(held, s)
+		return "\x00" + strconv.Itoa(len(held)-1) + "\x00"
+	}
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(m string) string {
+		return hold("<code>" + html.EscapeString(codeSpanPattern.FindStringSubmatch(m)[1]) + "</code>")
+	})
+	text = linkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		label := html.EscapeString(parts[1])
+		if !isSafeURL(parts[2]) {
+			return hold(label)
+		}
+		return hold(`<a href="` + html.EscapeString(parts[2]) + `" rel="nofollow noopener" target="_blank">` + label + "</a>")
+	})
+
+	text = html.EscapeString(text)
+	text = strongPattern.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = emphasisPattern.ReplaceAllString(text, "<em>$1$2</em>")
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(m string) string {
+		index, err := strconv.Atoi(placeholderPattern.FindStringSubmatch(m)[1])
+		if err == nil && index < len(held) {
+			return held[index]
+		}
+		return ""
+	})
+}
+
+// isSafeURL only allows links that cannot run script in the browser
+func isSafeURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Package mfa lets users turn on two-factor authentication with an authenticator app
+// (TOTP). Once it is on, UserLogin only returns a short-lived token that the second
+// login step exchanges for a full token together with a code; recovery codes stand in
+// for the app if it is lost.
+package mfa
+
+import (
+	"backend/apierror"
+	"backend/audit"
+	"backend/db"
+	"backend/encryption"
+	"backend/identity"
+	"backend/model"
+	"backend/profile"
+	"backend/totp"
+	"backend/validation"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// StatusHandler tells whether two-factor authentication is on and how many recovery
+// codes are left
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	user, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":           user.TOTPEnabled,
+		"recoveryCodesLeft": len(user.RecoveryCodes),
+	})
+}
+
+// SetupHandler creates a new secret for the user's authenticator app. It is returned
+// both as a provisioning URI, to be shown as a QR code, and as text for typing it in.
+// Two-factor authentication is turned on once EnableHandler gets a code made from it.
+func SetupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.MFASetupRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !profile.Reauthenticate(w, userID, request.CurrentPassword, request.EmailCode) {
+		return
+	}
+	user, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		apierror.Write(w, http.StatusConflict, apierror.MFAAlreadyEnabled, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create secret")
+		return
+	}
+	sealed, err := sealSecret(userID, secret)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to encrypt secret")
+		return
+	}
+	_, err = identity.UserRef(userID).Update(db.Ctx, []firestore.Update{{Path: "TOTPPendingSecret", Value: sealed}})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to save secret")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret": secret,
+		"uri":    totp.URI(secret, Issuer, user.Email),
+	})
+}
+
+// EnableHandler turns on two-factor authentication with a code from the app that was
+// just set up, and returns the recovery codes. They are shown only this once.
+func EnableHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.MFACodeRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	user, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		apierror.Write(w, http.StatusConflict, apierror.MFAAlreadyEnabled, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidRequest, "Set up two-factor authentication first")
+		return
+	}
+
+	secret, err := openSecret(userID, user.TOTPPendingSecret)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to decrypt secret")
+		return
+	}
+	step, valid := totp.Validate(secret, request.Code, time.Now())
+	if !valid {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidMFACode, "Invalid two-factor code")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create recovery codes")
+		return
+	}
+	userRef := identity.UserRef(userID)
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(userRef, []firestore.Update{
+			{Path: "TOTPEnabled", Value: true},
+			{Path: "TOTPSecret", Value: user.TOTPPendingSecret},
+			{Path: "TOTPPendingSecret", Value: firestore.Delete},
+			{Path: "TOTPLastStep", Value: step},
+			{Path: "RecoveryCodes", Value: hashes},
+		}); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.MFAEnable)
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to enable two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableHandler turns off two-factor authentication. It takes both the password and a
+// code from the app or a recovery code.
+func DisableHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.MFADisableRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !profile.Reauthenticate(w, userID, request.CurrentPassword, request.EmailCode) || !checkCode(w, r, userID, request.Code) {
+		return
+	}
+
+	userRef := identity.UserRef(userID)
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(userRef, []firestore.Update{
+			{Path: "TOTPEnabled", Value: false},
+			{Path: "TOTPSecret", Value: firestore.Delete},
+			{Path: "TOTPLastStep", Value: firestore.Delete},
+			{Path: "RecoveryCodes", Value: firestore.Delete},
+		}); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.MFADisable)
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to disable two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RecoveryCodesHandler replaces the user's recovery codes with new ones, given a code
+// from the app or one of the old recovery codes
+func RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.MFACodeRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !checkCode(w, r, userID, request.Code) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create recovery codes")
+		return
+	}
+	userRef := identity.UserRef(userID)
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(userRef, []firestore.Update{{Path: "RecoveryCodes", Value: hashes}}); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.RecoveryCodesRenew)
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to save recovery codes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recoveryCodes": codes})
+}
+
+// checkCode runs Verify and writes the error response if the code isn't accepted
+func checkCode(w http.ResponseWriter, r *http.Request, userID, code string) bool {
+	ok, err := Verify(r, userID, code)
+	switch {
+	case errors.Is(err, ErrNotEnabled):
+		apierror.Write(w, http.StatusBadRequest, apierror.MFANotEnabled, "Two-factor authentication is not enabled")
+		return false
+	case err != nil:
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check two-factor code")
+		return false
+	case !ok:
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidMFACode, "Invalid two-factor code")
+		return false
+	}
+	return true
+}
+
+func loadUser(w http.ResponseWriter, userID string) (*model.User, bool) {
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return nil, false
+	}
+	var user model.User
+	if err := doc.DataTo(&user); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse user data")
+		return nil, false
+	}
+	return &user, true
+}
+
+// sealSecret encrypts a TOTP secret with the user's data key, if encryption is configured
+func sealSecret(userID, secret string) (string, error) {
+	key, err := encryption.UserKey(userID)
+	if err != nil {
+		return "", err
+	}
+	return encryption.Encrypt(key, secret)
+}
+
+func openSecret(userID, sealed string) (string, error) {
+	key, err := encryption.UserKey(userID)
+	if err != nil {
+		return "", err
+	}
+	return encryption.Decrypt(key, sealed)
+}
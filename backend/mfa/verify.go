@@ -0,0 +1,114 @@
+package mfa
+
+import (
+	"backend/audit"
+	"backend/db"
+	"backend/encryption"
+	"backend/identity"
+	"backend/model"
+	"backend/totp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Issuer names the app in authenticator apps
+const Issuer = "DailyVerse"
+
+// Number of recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// ErrNotEnabled is returned by Verify for users without two-factor authentication
+var ErrNotEnabled = errors.New("two-factor authentication is not enabled")
+
+// Verify checks a code from the user's authenticator app or one of their recovery codes.
+// An app code is only accepted once, and a recovery code is used up.
+func Verify(r *http.Request, userID, code string) (bool, error) {
+	key, err := encryption.UserKey(userID)
+	if err != nil {
+		return false, err
+	}
+
+	userRef := identity.UserRef(userID)
+	var ok bool
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ok = false
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user model.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if !user.TOTPEnabled {
+			return ErrNotEnabled
+		}
+
+		secret, err := encryption.Decrypt(key, user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		if step, valid := totp.Validate(secret, code, time.Now()); valid {
+			if step <= user.TOTPLastStep {
+				return nil // already used
+			}
+			ok = true
+			return tx.Update(userRef, []firestore.Update{{Path: "TOTPLastStep", Value: step}})
+		}
+
+		hash := hashRecoveryCode(code)
+		for i, stored := range user.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) != 1 {
+				continue
+			}
+			remaining := append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+			ok = true
+			if err := tx.Update(userRef, []firestore.Update{{Path: "RecoveryCodes", Value: remaining}}); err != nil {
+				return err
+			}
+			return audit.Add(tx, r, userID, audit.RecoveryCodeUsed)
+		}
+		return nil
+	})
+	return ok, err
+}
+
+// newRecoveryCodes returns fresh recovery codes, formatted for the user, and the hashes
+// to store
+func newRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567" // base32: no 0 or 1 to mix up with o and l
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		var b strings.Builder
+		for j, c := range random {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(alphabet[c&31])
+		}
+		codes[i] = b.String()
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code as typed, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
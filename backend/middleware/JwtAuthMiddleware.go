@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"backend/apierror"
 	"backend/model"
 	"context"
 	"github.com/dgrijalva/jwt-go"
@@ -13,31 +14,65 @@ var jwtSecretKey = os.Getenv("JWT_SECRET_KEY")
 
 func JwtAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization token is missing", http.StatusUnauthorized)
+		claims, ok := parseToken(w, r)
+		if !ok {
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "Authorization token format must be 'Bearer <token>'", http.StatusUnauthorized)
+		// A login with two-factor authentication isn't finished until the second step
+		if claims.MFAPending {
+			apierror.Write(w, http.StatusUnauthorized, apierror.MFARequired, "Two-factor authentication is required to finish logging in")
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &model.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecretKey), nil
-		})
+		// Pass the user's ID to the next handler using context
+		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+// MFAPendingMiddleware only accepts the token UserLogin issues to users with two-factor
+// authentication, and passes the user's ID on to the second login step
+func MFAPendingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := parseToken(w, r)
+		if !ok {
+			return
+		}
+		if !claims.MFAPending {
+			apierror.Write(w, http.StatusUnauthorized, apierror.TokenInvalid, "This step needs the token from the password step of the login")
 			return
 		}
 
-		// Pass the user's email to the next handler using context
-		ctx := context.WithValue(r.Context(), "userEmail", claims.Email)
+		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// parseToken reads and checks the bearer token of r, answering 401 if it is missing or invalid
+func parseToken(w http.ResponseWriter, r *http.Request) (*model.Claims, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.TokenMissing, "Authorization token is missing")
+		return nil, false
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.TokenInvalid, "Authorization token format must be 'Bearer <token>'")
+		return nil, false
+	}
+
+	tokenString := parts[1]
+	claims := &model.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(jwtSecretKey), nil
+	})
+
+	// Tokens issued before user IDs carry only an email and must be renewed by logging in
+	if err != nil || !token.Valid || claims.UserID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid or expired token")
+		return nil, false
+	}
+	return claims, true
+}
@@ -2,44 +2,78 @@
 package middleware
 
 import (
+	"backend/apierror"
 	"golang.org/x/time/rate"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Limit is how many requests a client may make to a group of routes. Routes with the
+// same Name share a bucket, so each group has its own budget. A client is the user for
+// routes that require a login and the IP address for the others.
+type Limit struct {
+	Name  string
+	Every time.Duration // One request is added back to the bucket this often
+	Burst int
+}
+
+var (
+	// AuthLimit covers logging in: the password, code, passkey, provider and link steps.
+	// It allows the retries of a normal login, and several people behind one address.
+	AuthLimit = Limit{Name: "auth", Every: 20 * time.Second, Burst: 20}
+
+	// SignupLimit covers creating accounts
+	SignupLimit = Limit{Name: "signup", Every: 6 * time.Minute, Burst: 10}
+
+	// EmailLimit covers requests that send an email with a code or link
+	EmailLimit = Limit{Name: "email", Every: 5 * time.Minute, Burst: 5}
+
+	// AccountLimit covers changes to a logged-in user's security settings and account
+	AccountLimit = Limit{Name: "account", Every: time.Minute, Burst: 20}
+)
+
 type client struct {
 	limiter  *rate.Limiter
 	lastSeen time.Time
+	refill   time.Duration // How long an empty bucket takes to fill up again
 }
 
 var (
 	clients         = make(map[string]*client)
 	mutex           sync.Mutex
-	rateLimit       = rate.Every(time.Hour / 5) // 5 requests per hour
-	burst           = 5                         // Burst size
-	cleanupInterval = time.Minute * 10          // Cleanup every 10 minutes
+	cleanupOnce     sync.Once
+	cleanupInterval = time.Minute * 10 // Cleanup every 10 minutes
 )
 
-// RateLimitMiddleware limits the number of requests per client.
-func RateLimitMiddleware(next http.Handler) http.Handler {
-	go cleanupClients()
+// RateLimit limits the number of requests per client to the routes sharing limit. On
+// routes that require a login it must run after the authentication middleware.
+func RateLimit(limit Limit, next http.Handler) http.Handler {
+	cleanupOnce.Do(func() { go cleanupClients() })
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getIP(r)
+		key := limit.Name + " ip:" + ClientIP(r)
+		if userID, ok := r.Context().Value("userID").(string); ok && userID != "" {
+			key = limit.Name + " user:" + userID
+		}
 
 		mutex.Lock()
-		c, exists := clients[ip]
+		c, exists := clients[key]
 		if !exists {
-			limiter := rate.NewLimiter(rateLimit, burst)
-			clients[ip] = &client{limiter, time.Now()}
-			c = clients[ip]
+			c = &client{
+				limiter: rate.NewLimiter(rate.Every(limit.Every), limit.Burst),
+				refill:  limit.Every * time.Duration(limit.Burst),
+			}
+			clients[key] = c
 		}
 		c.lastSeen = time.Now()
 		mutex.Unlock()
 
 		if !c.limiter.Allow() {
-			http.Error(w, "Too many requests. Please try again later.", http.StatusTooManyRequests)
+			apierror.Write(w, http.StatusTooManyRequests, apierror.RateLimited, "Too many requests. Please try again later.")
 			return
 		}
 
@@ -47,24 +81,53 @@ func RateLimitMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// getIP extracts the client's real IP address from the request.
-func getIP(r *http.Request) string {
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// X-Forwarded-For can contain multiple IPs; the first is the client
-		return xff
+// ClientIP extracts the client's real IP address from the request. X-Forwarded-For is
+// only believed as far as our own proxies: each one appends the address it got the
+// request from, so the entries are read from the right, skipping private addresses,
+// and the first public one is the client. Anything left of it was sent by the client
+// and could be made up.
+func ClientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		ip = hop
+		if !isProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// isProxy reports whether ip is on a private network, where our proxies run
+func isProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
 	}
-	return r.RemoteAddr
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate()
 }
 
-// cleanupClients removes clients that haven't been seen for a while.
+// cleanupClients removes clients whose bucket has filled up again since they were last
+// seen, so forgetting them doesn't give anyone extra requests
 func cleanupClients() {
 	for {
 		time.Sleep(cleanupInterval)
 		mutex.Lock()
-		for ip, c := range clients {
-			if time.Since(c.lastSeen) > cleanupInterval {
-				delete(clients, ip)
+		for key, c := range clients {
+			if time.Since(c.lastSeen) > c.refill {
+				delete(clients, key)
 			}
 		}
 		mutex.Unlock()
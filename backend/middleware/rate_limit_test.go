@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:51234", want: "203.0.113.7"},
+		{name: "direct with a made-up header", remoteAddr: "203.0.113.7:51234", forwarded: "198.51.100.1", want: "203.0.113.7"},
+		{name: "through our proxy", remoteAddr: "10.0.1.5:40000", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "made-up entries before ours", remoteAddr: "10.0.1.5:40000", forwarded: "192.0.2.99, 198.51.100.1", want: "198.51.100.1"},
+		{name: "through two proxies", remoteAddr: "127.0.0.1:40000", forwarded: "198.51.100.1, 10.0.1.5", want: "198.51.100.1"},
+		{name: "proxy without header", remoteAddr: "10.0.1.5:40000", want: "10.0.1.5"},
+		{name: "garbage in the header", remoteAddr: "10.0.1.5:40000", forwarded: "198.51.100.1, not-an-ip", want: "10.0.1.5"},
+		{name: "ipv6", remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	first := RateLimit(Limit{Name: "test-first", Every: time.Hour, Burst: 2}, ok)
+	second := RateLimit(Limit{Name: "test-second", Every: time.Hour, Burst: 2}, ok)
+
+	request := func(h http.Handler, remoteAddr, userID string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if userID != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	steps := []struct {
+		name    string
+		handler http.Handler
+		addr    string
+		userID  string
+		want    int
+	}{
+		{"first request", first, "203.0.113.7:1", "", http.StatusOK},
+		{"new port, same client", first, "203.0.113.7:2", "", http.StatusOK},
+		{"bucket empty", first, "203.0.113.7:3", "", http.StatusTooManyRequests},
+		{"other group has its own bucket", second, "203.0.113.7:4", "", http.StatusOK},
+		{"other address has its own bucket", first, "203.0.113.8:1", "", http.StatusOK},
+		{"logged-in user is limited by user", first, "203.0.113.7:5", "user-1", http.StatusOK},
+		{"same user, other address", first, "198.51.100.1:1", "user-1", http.StatusOK},
+		{"user bucket empty", first, "198.51.100.2:1", "user-1", http.StatusTooManyRequests},
+	}
+	for _, step := range steps {
+		if got := request(step.handler, step.addr, step.userID); got != step.want {
+			t.Errorf("%s: status %d, want %d", step.name, got, step.want)
+		}
+	}
+}
@@ -9,34 +9,135 @@ import (
 // User model for signup and login
 // User model for signup and login
 type User struct {
-	Username      string    `json:"username"`
-	UsernameLower string    `json:"usernameLower"`
-	Email         string    `json:"email"`
-	Password      string    `json:"password"`
-	Country       string    `json:"country"`
-	City          string    `json:"city"`
-	ImageURL      string    `json:"imageUrl,omitempty"`
-	FirstName     string    `json:"firstName,omitempty"`
-	LastName      string    `json:"lastName,omitempty"`
-	IsVerified    bool      `json:"isVerified"`
-	OTP           string    `json:"-"`
-	OTPExpiresAt  time.Time `json:"-"`
+	UserID        string `json:"userID"` // Also the document ID; never changes
+	Username      string `json:"username"`
+	UsernameLower string `json:"usernameLower"`
+	Email         string `json:"email"` // Unique, registered in emails/{address}
+	Password      string `json:"password"`
+	Country       string `json:"country"`
+	CountryCode   string `json:"countryCode,omitempty"` // ISO 3166-1 alpha-2, if the client sent it
+	City          string `json:"city"`
+	ImageURL      string `json:"imageUrl,omitempty"`
+	FirstName     string `json:"firstName,omitempty"`
+	LastName      string `json:"lastName,omitempty"`
+	IsVerified    bool   `json:"isVerified"`
+
+	// Language the user's emails are written in, e.g. en or nb (see email.Languages)
+	Language string `json:"language,omitempty"`
+
+	// OTPs holds the codes sent by email that haven't been used yet, by purpose (see package otp)
+	OTPs map[string]OTP `json:"-"`
+
+	// MagicLinks holds the ID of the newest unused emailed link, by purpose (see package magiclink)
+	MagicLinks map[string]string `json:"-"`
+
+	// PendingEmail is the address the user asked to change to, if any. It replaces Email
+	// once the code sent to that address is confirmed.
+	PendingEmail            string    `json:"-"`
+	PendingEmailRequestedAt time.Time `json:"-"`
+
+	// Two-factor authentication. TOTPSecret is encrypted with the user's data key and
+	// RecoveryCodes holds SHA-256 hashes of the unused recovery codes.
+	TOTPEnabled       bool     `json:"-"`
+	TOTPSecret        string   `json:"-"`
+	TOTPPendingSecret string   `json:"-"` // Set up but not yet confirmed with a code
+	TOTPLastStep      int64    `json:"-"` // Period of the last accepted code, so codes can't be replayed
+	RecoveryCodes     []string `json:"-"`
+}
+
+// OTP is a one-time code sent by email. Only a salted hash of the code is kept.
+type OTP struct {
+	Hash      string
+	Salt      string
+	ExpiresAt time.Time
+	Attempts  int // Wrong guesses so far
+}
+
+// OutboxEmail is an email waiting to be sent or already handled, stored at outbox/{id}.
+// The body is cleared once the email is sent or given up on, since it may hold a code.
+type OutboxEmail struct {
+	To        string
+	Template  string
+	Language  string
+	Subject   string
+	Text      string
+	HTML      string
+	Status    string // "pending", "sending", "sent" or "failed"
+	Attempts  int
+	LastError string `firestore:",omitempty"`
+	CreatedAt time.Time
+
+	// NextAttemptAt is when the email is due; it is removed once the email is sent or
+	// failed, so only emails with work left match the worker's query
+	NextAttemptAt time.Time `firestore:",omitempty"`
+	FinishedAt    time.Time `firestore:",omitempty"`
+}
+
+// Profile is the part of a user document the user sees on their profile page
+type Profile struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	Country     string `json:"country"`
+	CountryCode string `json:"countryCode,omitempty"`
+	City        string `json:"city"`
+	FirstName   string `json:"firstName,omitempty"`
+	LastName    string `json:"lastName,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	Language    string `json:"language,omitempty"`
+}
+
+// AuditEntry records one change to a user's account, stored under users/{userID}/audit
+type AuditEntry struct {
+	Action    string    `json:"action"`           // e.g. "profile.update" or "password.change"
+	Fields    []string  `json:"fields,omitempty"` // Profile fields that changed
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Passkey is a WebAuthn credential a user can log in with, stored under
+// users/{userID}/passkeys/{id}. Only the public key is kept.
+type Passkey struct {
+	ID              string    `json:"id"` // Credential ID, base64url; also the document ID
+	Name            string    `json:"name"`
+	PublicKey       []byte    `json:"-"`
+	AttestationType string    `json:"-"`
+	Transports      []string  `json:"transports,omitempty"`
+	AAGUID          []byte    `json:"-"`
+	SignCount       int64     `json:"-"`
+	UserVerified    bool      `json:"-"`
+	BackupEligible  bool      `json:"backupEligible"` // Synced passkey, e.g. in a password manager
+	BackupState     bool      `json:"-"`
+	CreatedAt       time.Time `json:"createdAt"`
+	LastUsedAt      time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// OIDCIdentity links an account at an OpenID Connect provider to a user, stored at
+// oidcIdentities/{id} where the ID is derived from the issuer and subject
+type OIDCIdentity struct {
+	UserID   string    `json:"userID"`
+	Provider string    `json:"provider"` // Configured name, e.g. "feide"
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"` // The provider's stable ID for the account
+	LinkedAt time.Time `json:"linkedAt"`
 }
 
 // Event model representing event details
 type Event struct {
-	EventID       string `json:"eventID"`
-	StreetAddress string `json:"streetAddress"`
-	PostalNumber  string `json:"postalNumber"`
-	Status        string `json:"status"`
-	Description   string `json:"description"`
-	Time          string `json:"time"`
-	EventTypeID   string `json:"eventTypeID"`
-	Date          string `json:"date"`
-	Email         string `json:"email"` // User's email as foreign key
-	Title         string `json:"title" firestore:"title"`
-	StartTime     string `json:"startTime" firestore:"startTime"`
-	EndTime       string `json:"endTime" firestore:"endTime"`
+	EventID       string `json:"eventID" validate:"max=128"`
+	StreetAddress string `json:"streetAddress" validate:"max=200"`
+	PostalNumber  string `json:"postalNumber" validate:"max=20"`
+	Status        string `json:"status" validate:"max=50"`
+	Description   string `json:"description" validate:"max=5000"`
+	Time          string `json:"time" validate:"max=50"`
+	EventTypeID   string `json:"eventTypeID" validate:"required,oneof=public private"`
+	Date          string `json:"date" validate:"required,date"`
+	UserID        string `json:"userID" validate:"max=128"`              // Owner; set by the server
+	Email         string `json:"email" firestore:"-" validate:"max=254"` // Owner's email, filled in when events are listed
+	Title         string `json:"title" firestore:"title" validate:"max=200"`
+	StartTime     string `json:"startTime" firestore:"startTime" validate:"omitempty,time"`
+	EndTime       string `json:"endTime" firestore:"endTime" validate:"omitempty,time"`
 }
 
 // EventType model for public or private events
@@ -47,22 +148,63 @@ type EventType struct {
 
 // Journal model for daily journal entries
 type Journal struct {
-	JournalID string `json:"journalID,omitempty"`
-	Date      string `json:"date"`
-	Content   string `json:"content"`
-	Email     string `json:"email"` // User's email as foreign key
+	JournalID string   `json:"journalID,omitempty" validate:"max=128"`
+	Date      string   `json:"date" validate:"omitempty,date"`
+	Title     string   `json:"title,omitempty" validate:"max=200"`
+	Content   string   `json:"content" validate:"required,max=100000"`       // Markdown source
+	Mood      int      `json:"mood,omitempty" validate:"min=0,max=5"`        // 1 (very bad) to 5 (very good), 0 if not set
+	Tags      []string `json:"tags,omitempty" validate:"max=20,dive,max=32"` // Lowercased on save
+	UserID    string   `json:"userID,omitempty" validate:"max=128"`          // Owner; set by the server
+
+	// Section is 0 for a day's main entry and 1, 2, ... for extra sections written the same day
+	Section int `json:"section,omitempty" validate:"min=0"`
+
+	// SharedWith lists the user IDs of friends who may read this entry
+	SharedWith []string `json:"sharedWith,omitempty"`
+
+	// HTML is Content rendered and sanitized on read; it is never stored
+	HTML string `json:"html,omitempty" firestore:"-"`
+
+	// SearchTokens holds the normalized words of Content and backs the journal search index
+	SearchTokens []string `json:"-"`
+}
+
+// JournalRevision is a prior version of a journal entry, kept whenever the entry is overwritten
+type JournalRevision struct {
+	RevisionID string    `json:"revisionID"`
+	JournalID  string    `json:"journalID"`
+	Date       string    `json:"date"`
+	Title      string    `json:"title,omitempty"`
+	Content    string    `json:"content"`
+	Mood       int       `json:"mood,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	SavedAt    time.Time `json:"savedAt"`
 }
 
-// Friend model to manage friendships between users
+// JournalReminder is a user's setting for the daily "write in your journal" email
+type JournalReminder struct {
+	Enabled  bool   `json:"enabled"`
+	Time     string `json:"time" validate:"omitempty,time"`         // Local time of day, HH:MM
+	TimeZone string `json:"timeZone" validate:"omitempty,timezone"` // IANA name, e.g. Europe/Oslo
+	Language string `json:"language" validate:"max=35"`             // Prompt language, e.g. en or nb
+	LastSent string `json:"lastSent,omitempty"`                     // Local date of the last reminder, YYYY-MM-DD
+}
+
+// Friend model to manage friendships between users, stored at friends/{userID}_{friendID}
 type Friend struct {
-	Email       string `json:"email"`       // Email of the user who sent the request
-	FriendEmail string `json:"friendEmail"` // Email of the user who received the request
-	Status      string `json:"status"`      // "pending" or "accepted"
+	UserID   string `json:"userID"`   // ID of the user who sent the request
+	FriendID string `json:"friendID"` // ID of the user who received the request
+	Status   string `json:"status"`   // "pending" or "accepted"
 }
 
-// JWT Claims structure
+// JWT Claims structure. Tokens name the user by ID so they stay valid across email changes.
 type Claims struct {
-	Email string `json:"email"`
+	UserID string `json:"uid"`
+
+	// MFAPending marks the short-lived token issued after the password step of a login
+	// with two-factor authentication. It is only accepted by the second login step.
+	MFAPending bool `json:"mfaPending,omitempty"`
+
 	jwt.StandardClaims
 }
 
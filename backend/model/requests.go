@@ -0,0 +1,150 @@
+package model
+
+// Request bodies that don't map onto a stored model. The validate tags are enforced by
+// validation.DecodeJSON and published in the OpenAPI spec.
+
+// SignupRequest registers a new account
+type SignupRequest struct {
+	Username    string `json:"username" validate:"required,max=32"`
+	Email       string `json:"email" validate:"required,email,max=254"`
+	Password    string `json:"password" validate:"required,min=8,max=128"`
+	Country     string `json:"country" validate:"required,max=100"`
+	CountryCode string `json:"countryCode" validate:"omitempty,iso2"`
+	City        string `json:"city" validate:"required,max=100"`
+	FirstName   string `json:"firstName" validate:"max=100"`
+	LastName    string `json:"lastName" validate:"max=100"`
+	ImageURL    string `json:"imageUrl" validate:"omitempty,url,max=2048"`
+	Language    string `json:"language" validate:"omitempty,oneof=en nb"` // Email language; taken from Accept-Language if left out
+}
+
+// LoginRequest exchanges credentials for a token
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,max=128"`
+}
+
+// EmailRequest names the account an email (verification code, password reset) goes to
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+// VerifyEmailRequest confirms an email address with the code sent to it
+type VerifyEmailRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+	OTP   string `json:"otp" validate:"required,len=6,digits"`
+}
+
+// ResetPasswordRequest sets a new password with the code from a reset email
+type ResetPasswordRequest struct {
+	Email       string `json:"email" validate:"required,email,max=254"`
+	OTP         string `json:"otp" validate:"required,len=6,digits"`
+	NewPassword string `json:"newPassword" validate:"required,min=8,max=128"`
+}
+
+// LinkRequest carries the token from a link sent by email
+type LinkRequest struct {
+	Token string `json:"token" validate:"required,max=1024"`
+}
+
+// LinkResetPasswordRequest sets a new password with the token from a reset link
+type LinkResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required,max=1024"`
+	NewPassword string `json:"newPassword" validate:"required,min=8,max=128"`
+}
+
+// UsernameRequest names another user, e.g. for friend requests
+type UsernameRequest struct {
+	Username string `json:"username" validate:"required,max=32"`
+}
+
+// UsernamesRequest names several users, e.g. to share a journal entry with
+type UsernamesRequest struct {
+	Usernames []string `json:"usernames" validate:"max=100,dive,required,max=32"`
+}
+
+// ProfileUpdate holds the profile fields a user may change. Fields left out of the
+// request keep their stored value.
+type ProfileUpdate struct {
+	Username    *string `json:"username" validate:"min=1,max=32"`
+	Country     *string `json:"country" validate:"max=100"`
+	CountryCode *string `json:"countryCode" validate:"omitempty,iso2"`
+	City        *string `json:"city" validate:"max=100"`
+	FirstName   *string `json:"firstName" validate:"max=100"`
+	LastName    *string `json:"lastName" validate:"max=100"`
+	ImageURL    *string `json:"imageUrl" validate:"omitempty,url,max=2048"`
+	Language    *string `json:"language" validate:"omitempty,oneof=en nb"`
+}
+
+// PasswordChangeRequest sets a new password for the logged-in user
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required,max=128"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8,max=128"`
+}
+
+// EmailChangeRequest asks to change the logged-in user's email address
+type EmailChangeRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"max=128"`
+	EmailCode       string `json:"emailCode" validate:"omitempty,len=6,digits"` // Instead of the password, for accounts without one
+	NewEmail        string `json:"newEmail" validate:"required,email,max=254"`
+}
+
+// EmailChangeConfirmRequest confirms an email change with the code sent to the new address
+type EmailChangeConfirmRequest struct {
+	OTP string `json:"otp" validate:"required,len=6,digits"`
+}
+
+// AccountDeleteRequest confirms deleting the logged-in user's account with their
+// password, or an emailed code for accounts without one
+type AccountDeleteRequest struct {
+	Password  string `json:"password" validate:"max=128"`
+	EmailCode string `json:"emailCode" validate:"omitempty,len=6,digits"`
+}
+
+// MFASetupRequest starts setting up two-factor authentication
+type MFASetupRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"max=128"`
+	EmailCode       string `json:"emailCode" validate:"omitempty,len=6,digits"` // Instead of the password, for accounts without one
+}
+
+// MFACodeRequest carries a code from the user's authenticator app, or a recovery code
+// where the endpoint accepts one
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// MFADisableRequest turns off two-factor authentication
+type MFADisableRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"max=128"`
+	EmailCode       string `json:"emailCode" validate:"omitempty,len=6,digits"` // Instead of the password, for accounts without one
+	Code            string `json:"code" validate:"required,max=32"`
+}
+
+// PasskeyBeginRequest starts adding a passkey. The password is asked for so a stolen
+// token can't be used to add a way into the account.
+type PasskeyBeginRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"max=128"`
+	EmailCode       string `json:"emailCode" validate:"omitempty,len=6,digits"` // Instead of the password, for accounts without one
+}
+
+// PasskeyRegistrationRequest finishes adding a passkey. Credential is the
+// PublicKeyCredential from navigator.credentials.create, with its binary fields
+// base64url-encoded.
+type PasskeyRegistrationRequest struct {
+	SessionID  string                 `json:"sessionID" validate:"required,max=64"`
+	Name       string                 `json:"name" validate:"max=64"`
+	Credential map[string]interface{} `json:"credential" validate:"required"`
+}
+
+// PasskeyLoginRequest finishes a passkey login. Credential is the PublicKeyCredential
+// from navigator.credentials.get, with its binary fields base64url-encoded.
+type PasskeyLoginRequest struct {
+	SessionID  string                 `json:"sessionID" validate:"required,max=64"`
+	Credential map[string]interface{} `json:"credential" validate:"required"`
+}
+
+// OIDCLoginRequest finishes a login with an OpenID Connect provider, with the state and
+// code the provider added to the redirect back to the app
+type OIDCLoginRequest struct {
+	State string `json:"state" validate:"required,max=128"`
+	Code  string `json:"code" validate:"required,max=2048"`
+}
@@ -1,6 +1,7 @@
 package news
 
 import (
+	"backend/apierror"
 	"backend/db" // Import Firestore database package
 	"context"
 	"encoding/json"
@@ -35,17 +36,17 @@ func FetchNewsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Initial Country: %s, Mode: %s, Limit: %d, Query: %s\n", country, mode, limit, query)
 
 	if mode == "local" && country == "" {
-		userEmail, ok := r.Context().Value("userEmail").(string)
-		if !ok || userEmail == "" {
-			log.Println("User email not found in context")
-			http.Error(w, "User email missing for local news", http.StatusBadRequest)
+		userID, ok := r.Context().Value("userID").(string)
+		if !ok || userID == "" {
+			log.Println("User ID not found in context")
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidCountry, "User ID missing for local news")
 			return
 		}
 
-		doc, err := db.Client.Collection("users").Doc(userEmail).Get(context.Background())
+		doc, err := db.Client.Collection("users").Doc(userID).Get(context.Background())
 		if err != nil {
 			log.Printf("Error fetching user profile: %v\n", err)
-			http.Error(w, "Failed to fetch user profile", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to fetch user profile")
 			return
 		}
 
@@ -54,7 +55,7 @@ func FetchNewsHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Retrieved Country from Profile: %s\n", country)
 		} else {
 			log.Println("Country not found in user profile")
-			http.Error(w, "Country not found in user profile", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidCountry, "Country not found in user profile")
 			return
 		}
 	}
@@ -65,7 +66,7 @@ func FetchNewsHandler(w http.ResponseWriter, r *http.Request) {
 		countryCode, languageCode, err := getCountryAndLanguageCode(country)
 		if err != nil {
 			log.Printf("Error getting country and language code: %v\n", err)
-			http.Error(w, "Invalid country for local news", http.StatusBadRequest)
+			apierror.Write(w, http.StatusBadRequest, apierror.InvalidCountry, "Invalid country for local news")
 			return
 		}
 		url = fmt.Sprintf("https://newsdata.io/api/1/news?country=%s&language=%s&apikey=%s", countryCode, languageCode, newsAPIKey)
@@ -83,7 +84,7 @@ func FetchNewsHandler(w http.ResponseWriter, r *http.Request) {
 	resp, err := http.Get(url)
 	if err != nil {
 		log.Printf("Error fetching news: %v\n", err)
-		http.Error(w, "Failed to fetch news", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Failed to fetch news")
 		return
 	}
 	defer resp.Body.Close()
@@ -95,7 +96,7 @@ func FetchNewsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		log.Printf("Error decoding news data: %v\n", err)
-		http.Error(w, "Failed to parse news data", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.UpstreamError, "Failed to parse news data")
 		return
 	}
 
@@ -0,0 +1,133 @@
+package openapi
+
+import (
+	"backend/validation"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaOf describes a request body type from its json and validate struct tags, so the
+// published spec says exactly what validation.DecodeJSON enforces. Route parameters are
+// described the same way, from a struct with one field per parameter. A doc tag on a
+// field becomes its description.
+func SchemaOf(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return schemaOfType(t, nil)
+}
+
+func schemaOfType(t reflect.Type, rules []validation.Rule) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var s *Schema
+	switch t.Kind() {
+	case reflect.String:
+		s = String()
+	case reflect.Bool:
+		s = Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		s = &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		s = &Schema{Type: "array"}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			s = String().Formatted("date-time")
+		} else {
+			s = &Schema{Type: "object", Properties: make(map[string]*Schema)}
+			addFields(s, t)
+		}
+	default:
+		s = &Schema{Type: "object"}
+	}
+
+	for i, rule := range rules {
+		if rule.Name == "dive" {
+			s.Items = schemaOfType(t.Elem(), rules[i+1:])
+			return s
+		}
+		applyRule(s, rule)
+	}
+	if s.Type == "array" && s.Items == nil {
+		s.Items = schemaOfType(t.Elem(), nil)
+	}
+	return s
+}
+
+// addFields adds the JSON fields of struct type t to the object schema s
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addFields(s, field.Type)
+			continue
+		}
+
+		name := validation.FieldName(field)
+		if name == "" {
+			continue
+		}
+		rules := validation.ParseTag(field.Tag.Get("validate"))
+		s.Properties[name] = schemaOfType(field.Type, rules)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			s.Properties[name].Description = doc
+		}
+		for _, rule := range rules {
+			if rule.Name == "dive" {
+				break // the rules after dive apply to the elements
+			}
+			if rule.Name == "required" {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+}
+
+// applyRule copies one validate rule onto the schema of the value it applies to
+func applyRule(s *Schema, rule validation.Rule) {
+	n, _ := strconv.Atoi(rule.Param)
+	switch rule.Name {
+	case "min", "max", "len":
+		switch s.Type {
+		case "string":
+			if rule.Name != "max" {
+				s.MinLength = &n
+			}
+			if rule.Name != "min" {
+				s.MaxLength = &n
+			}
+		case "array":
+			if rule.Name != "min" {
+				s.MaxItems = &n
+			}
+		case "integer", "number":
+			f := float64(n)
+			if rule.Name != "max" {
+				s.Minimum = &f
+			}
+			if rule.Name != "min" {
+				s.Maximum = &f
+			}
+		}
+	case "oneof":
+		s.Enum = strings.Fields(rule.Param)
+	case "email", "date", "time":
+		s.Format = rule.Name
+	case "url":
+		s.Format = "uri"
+	case "timezone":
+		s.Description = "IANA time zone, e.g. Europe/Oslo"
+	case "digits":
+		s.Pattern = "^[0-9]+$"
+	case "iso2":
+		s.Pattern = "^[A-Z]{2}$"
+	}
+}
@@ -0,0 +1,64 @@
+package openapi
+
+// Schema is the subset of the OpenAPI 3 schema object the API uses. Request bodies and
+// parameters are described with SchemaOf, from the same validate tags the handlers enforce.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+}
+
+// Object returns an object schema with the given properties
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// String returns a string schema
+func String() *Schema { return &Schema{Type: "string"} }
+
+// Boolean returns a boolean schema
+func Boolean() *Schema { return &Schema{Type: "boolean"} }
+
+// ArrayOf returns an array schema whose elements match items
+func ArrayOf(items *Schema) *Schema { return &Schema{Type: "array", Items: items} }
+
+// Formatted sets the string format, e.g. "email" or "date"
+func (s *Schema) Formatted(format string) *Schema {
+	s.Format = format
+	return s
+}
+
+// Require marks properties as required in addition to those the schema already requires
+func (s *Schema) Require(names ...string) *Schema {
+	for _, name := range names {
+		if !contains(s.Required, name) {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// Describe sets the description shown in the spec
+func (s *Schema) Describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
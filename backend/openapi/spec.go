@@ -0,0 +1,169 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Route documents one operation of the API
+type Route struct {
+	Pattern   string  // Method and path relative to the server URL, e.g. "GET /events/{id}"
+	Summary   string  // One-line description
+	Tag       string  // Group shown in API browsers, e.g. "Events"
+	Auth      bool    // Requires a bearer token
+	Params    *Schema // Path and query parameters, from SchemaOf of a struct; unlisted path parameters are strings
+	Body      *Schema // JSON request body, nil if the route takes none
+	FileField string  // Form field of a multipart file upload, if any
+}
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       map[string]string               `json:"info"`
+	Servers    []map[string]string             `json:"servers"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components map[string]interface{}          `json:"components"`
+}
+
+// Operation is an OpenAPI 3 operation object
+type Operation struct {
+	Summary     string                 `json:"summary"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody map[string]interface{} `json:"requestBody,omitempty"`
+	Responses   map[string]interface{} `json:"responses"`
+	Security    []map[string][]string  `json:"security,omitempty"`
+}
+
+// Parameter is an OpenAPI 3 path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// ErrorSchema is the body of every error response
+var ErrorSchema = Object(map[string]*Schema{
+	"code":    String().Describe("Stable machine-readable error code, e.g. EVENT_NOT_FOUND"),
+	"message": String(),
+	"details": ArrayOf(Object(map[string]*Schema{
+		"field":   String(),
+		"message": String(),
+	})).Describe("Fields that failed validation"),
+	"meta":      &Schema{Type: "object", Description: "Extra data for some errors, e.g. the conflicting journalID"},
+	"requestId": String(),
+}, "code", "message")
+
+// Build creates the spec for the routes of one API version served under serverURL
+func Build(title, version, serverURL string, routes []Route) Document {
+	doc := Document{
+		OpenAPI: "3.0.3",
+		Info:    map[string]string{"title": title, "version": version},
+		Servers: []map[string]string{{"url": serverURL}},
+		Paths:   make(map[string]map[string]Operation),
+		Components: map[string]interface{}{
+			"schemas": map[string]*Schema{"Error": ErrorSchema},
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route.Pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+
+		op := Operation{
+			Summary: route.Summary,
+			Responses: map[string]interface{}{
+				"2XX": map[string]string{"description": "Success"},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]string{"$ref": "#/components/schemas/Error"},
+						},
+					},
+				},
+			},
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+		if route.Auth {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+		op.Parameters = parameters(path, route.Params)
+		switch {
+		case route.Body != nil:
+			op.RequestBody = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]*Schema{"schema": route.Body}},
+			}
+		case route.FileField != "":
+			upload := Object(map[string]*Schema{route.FileField: String().Formatted("binary")}, route.FileField)
+			op.RequestBody = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"multipart/form-data": map[string]*Schema{"schema": upload}},
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]Operation)
+		}
+		doc.Paths[path][strings.ToLower(method)] = op
+	}
+	return doc
+}
+
+// parameters lists the path parameters of path, then the other properties of params as
+// query parameters in name order
+func parameters(path string, params *Schema) []Parameter {
+	properties := make(map[string]*Schema)
+	if params != nil {
+		for name, s := range params.Properties {
+			properties[name] = s
+		}
+	}
+
+	var list []Parameter
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.Trim(segment, "{}")
+			s := properties[name]
+			if s == nil {
+				s = String()
+			}
+			delete(properties, name)
+			list = append(list, Parameter{Name: name, In: "path", Required: true, Schema: s})
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, Parameter{
+			Name: name, In: "query", Required: contains(params.Required, name), Schema: properties[name],
+		})
+	}
+	return list
+}
+
+// Handler serves a spec as JSON
+func Handler(doc Document) http.HandlerFunc {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
@@ -0,0 +1,47 @@
+package openapi
+
+import "testing"
+
+func TestParameters(t *testing.T) {
+	type dayParams struct {
+		Date    string `json:"date" validate:"required,date"`
+		Section int    `json:"section" validate:"omitempty,min=0" doc:"Extra section"`
+		Q       string `json:"q" validate:"required"`
+	}
+
+	params := parameters("/journal-days/{date}/{id}", SchemaOf(dayParams{}))
+	if len(params) != 4 {
+		t.Fatalf("got %d parameters, want 4: %+v", len(params), params)
+	}
+
+	tests := []struct {
+		name, in, typ, format string
+		required              bool
+	}{
+		{"date", "path", "string", "date", true},
+		{"id", "path", "string", "", true},
+		{"q", "query", "string", "", true},
+		{"section", "query", "integer", "", false},
+	}
+	for i, tt := range tests {
+		p := params[i]
+		if p.Name != tt.name || p.In != tt.in || p.Required != tt.required ||
+			p.Schema.Type != tt.typ || p.Schema.Format != tt.format {
+			t.Errorf("parameter %d = %s in %s (%s/%s, required %v), want %s in %s (%s/%s, required %v)",
+				i, p.Name, p.In, p.Schema.Type, p.Schema.Format, p.Required,
+				tt.name, tt.in, tt.typ, tt.format, tt.required)
+		}
+	}
+
+	section := params[3].Schema
+	if section.Minimum == nil || *section.Minimum != 0 || section.Description != "Extra section" {
+		t.Errorf("section schema = %+v, want minimum 0 and the doc tag as description", section)
+	}
+}
+
+func TestParametersWithoutSchema(t *testing.T) {
+	params := parameters("/events/{id}", nil)
+	if len(params) != 1 || params[0].Name != "id" || params[0].Schema.Type != "string" {
+		t.Errorf("parameters = %+v, want the id path parameter as a string", params)
+	}
+}
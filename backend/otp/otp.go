@@ -0,0 +1,159 @@
+// Package otp issues and checks the six-digit codes sent by email. Codes come from
+// crypto/rand and only a salted hash is stored, under the user's OTPs field by purpose,
+// so a code sent for one purpose can't be used for another. Each code allows a few
+// wrong guesses before it is used up.
+package otp
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/model"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Purpose says what a code is for
+type Purpose string
+
+const (
+	Signup        Purpose = "signup"         // Verifying the address of a new account
+	PasswordReset Purpose = "password_reset" // Setting a new password
+	EmailChange   Purpose = "email_change"   // Confirming a new address for the account
+	Reauth        Purpose = "reauth"         // Confirming a sensitive change on an account without a password
+)
+
+// MaxAttempts is how many wrong guesses a code allows
+const MaxAttempts = 5
+
+var (
+	// ErrInvalid is returned for a wrong code, or when no code was sent for the purpose
+	ErrInvalid = errors.New("invalid code")
+
+	// ErrExpired is returned for a code past its lifetime
+	ErrExpired = errors.New("code has expired")
+
+	// ErrTooManyAttempts is returned once a code has had MaxAttempts wrong guesses
+	ErrTooManyAttempts = errors.New("too many wrong codes")
+)
+
+// Field returns the path of the user document field holding the code for purpose
+func Field(purpose Purpose) string {
+	return "OTPs." + string(purpose)
+}
+
+// New makes a code valid for lifetime. The record is stored at Field(purpose) and the
+// code is sent to the user.
+func New(purpose Purpose, lifetime time.Duration) (string, model.OTP, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", model.OTP{}, err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", model.OTP{}, err
+	}
+	saltText := base64.RawStdEncoding.EncodeToString(salt)
+	return code, model.OTP{
+		Hash:      hash(saltText, purpose, code),
+		Salt:      saltText,
+		ExpiresAt: time.Now().Add(lifetime),
+	}, nil
+}
+
+// Issue makes a code for purpose and stores it on the user, replacing any earlier one
+func Issue(userRef *firestore.DocumentRef, purpose Purpose, lifetime time.Duration) (string, error) {
+	code, record, err := New(purpose, lifetime)
+	if err != nil {
+		return "", err
+	}
+	_, err = userRef.Update(db.Ctx, []firestore.Update{{Path: Field(purpose), Value: record}})
+	return code, err
+}
+
+// Verify checks code against the user's code for purpose. A right code is used up; a
+// wrong one counts as an attempt.
+func Verify(userRef *firestore.DocumentRef, purpose Purpose, code string) error {
+	var result error
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		result = nil
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user model.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+
+		record, ok := user.OTPs[string(purpose)]
+		var updates []firestore.Update
+		updates, result = judge(record, ok, purpose, code, time.Now())
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Update(userRef, updates)
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// judge decides what a guess does to the stored code for purpose: the result to report
+// and the updates to save. A right code is deleted; a wrong one counts as an attempt.
+func judge(record model.OTP, found bool, purpose Purpose, code string, now time.Time) ([]firestore.Update, error) {
+	switch {
+	case !found:
+		return nil, ErrInvalid
+	case record.Attempts >= MaxAttempts:
+		return nil, ErrTooManyAttempts
+	case now.After(record.ExpiresAt):
+		return nil, ErrExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash(record.Salt, purpose, code)), []byte(record.Hash)) != 1 {
+		// Saved, not rolled back, so guesses add up
+		result := ErrInvalid
+		if record.Attempts+1 >= MaxAttempts {
+			result = ErrTooManyAttempts
+		}
+		return []firestore.Update{{Path: Field(purpose) + ".Attempts", Value: firestore.Increment(1)}}, result
+	}
+	return []firestore.Update{{Path: Field(purpose), Value: firestore.Delete}}, nil
+}
+
+// Check runs Verify and writes the error response if the code isn't accepted
+func Check(w http.ResponseWriter, userRef *firestore.DocumentRef, purpose Purpose, code string) bool {
+	err := Verify(userRef, purpose, code)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrInvalid):
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidOTP, "Invalid OTP")
+	case errors.Is(err, ErrExpired):
+		apierror.Write(w, http.StatusBadRequest, apierror.OTPExpired, "OTP has expired")
+	case errors.Is(err, ErrTooManyAttempts):
+		apierror.Write(w, http.StatusTooManyRequests, apierror.OTPAttemptsExceeded, "Too many wrong codes. Please request a new one.")
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check OTP")
+	}
+	return false
+}
+
+func hash(salt string, purpose Purpose, code string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + string(purpose) + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
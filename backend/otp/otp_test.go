@@ -0,0 +1,83 @@
+package otp
+
+import (
+	"backend/model"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestNew(t *testing.T) {
+	code, record, err := New(Signup, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\d{6}$`).MatchString(code) {
+		t.Errorf("New() code = %q, want six digits", code)
+	}
+	if record.Hash == "" || record.Salt == "" || record.Hash == code {
+		t.Errorf("New() record = %+v, want a salted hash of the code", record)
+	}
+	if _, other, _ := New(Signup, 5*time.Minute); other.Salt == record.Salt {
+		t.Error("New() reused a salt")
+	}
+}
+
+func TestJudge(t *testing.T) {
+	now := time.Now()
+	code, record, err := New(PasswordReset, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	withAttempts := func(n int) model.OTP {
+		r := record
+		r.Attempts = n
+		return r
+	}
+	expired := record
+	expired.ExpiresAt = now.Add(-time.Second)
+
+	attempt := firestore.Update{Path: "OTPs.password_reset.Attempts", Value: firestore.Increment(1)}
+	used := firestore.Update{Path: "OTPs.password_reset", Value: firestore.Delete}
+	signupAttempt := firestore.Update{Path: "OTPs.signup.Attempts", Value: firestore.Increment(1)}
+
+	tests := []struct {
+		name    string
+		record  model.OTP
+		found   bool
+		purpose Purpose
+		code    string
+		want    error
+		update  *firestore.Update
+	}{
+		{name: "right code", record: record, found: true, purpose: PasswordReset, code: code, want: nil, update: &used},
+		{name: "wrong code", record: record, found: true, purpose: PasswordReset, code: wrong, want: ErrInvalid, update: &attempt},
+		{name: "last wrong guess", record: withAttempts(MaxAttempts - 1), found: true, purpose: PasswordReset, code: wrong, want: ErrTooManyAttempts, update: &attempt},
+		{name: "right code after too many guesses", record: withAttempts(MaxAttempts), found: true, purpose: PasswordReset, code: code, want: ErrTooManyAttempts},
+		{name: "expired", record: expired, found: true, purpose: PasswordReset, code: code, want: ErrExpired},
+		{name: "no code sent", found: false, purpose: PasswordReset, code: code, want: ErrInvalid},
+		// The hash covers the purpose, so a reset code counts as a wrong signup code
+		{name: "code for another purpose", record: record, found: true, purpose: Signup, code: code, want: ErrInvalid, update: &signupAttempt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, err := judge(tt.record, tt.found, tt.purpose, tt.code, now)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("judge() error = %v, want %v", err, tt.want)
+			}
+			switch {
+			case tt.update == nil && len(updates) != 0:
+				t.Errorf("judge() updates = %+v, want none", updates)
+			case tt.update != nil && (len(updates) != 1 || updates[0].Path != tt.update.Path):
+				t.Errorf("judge() updates = %+v, want %+v", updates, *tt.update)
+			}
+		})
+	}
+}
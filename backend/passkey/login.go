@@ -0,0 +1,84 @@
+package passkey
+
+import (
+	"backend/db"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ErrInvalidCredential is returned by FinishLogin when the passkey's answer doesn't check out
+var ErrInvalidCredential = errors.New("passkey could not be verified")
+
+// BeginLogin starts a passkey login and returns the options for navigator.credentials.get
+// and the session ID to finish it with. No user is named: the browser offers every
+// passkey it has for the site.
+func BeginLogin() (*protocol.CredentialAssertion, string, error) {
+	rp, err := webAuthn()
+	if err != nil {
+		return nil, "", err
+	}
+	assertion, data, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := saveSession("", purposeLogin, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishLogin checks the browser's answer to a login started with BeginLogin and returns
+// the ID of the user the passkey belongs to. The passkey's signature counter and last use
+// are updated; a counter that went backwards means the passkey may have been cloned and
+// the login is refused.
+func FinishLogin(sessionID string, credential map[string]interface{}) (string, error) {
+	rp, err := webAuthn()
+	if err != nil {
+		return "", err
+	}
+	data, err := takeSession(sessionID, "", purposeLogin)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := reencode(credential)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+
+	var userID string
+	found, err := rp.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID = string(userHandle)
+		if userID == "" {
+			return nil, errors.New("empty user handle")
+		}
+		return loadUser(userID)
+	}, *data, parsed)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+	if found.Authenticator.CloneWarning {
+		return "", fmt.Errorf("%w: signature counter went backwards", ErrInvalidCredential)
+	}
+
+	_, err = passkeysRef(userID).Doc(base64.RawURLEncoding.EncodeToString(found.ID)).Update(db.Ctx, []firestore.Update{
+		{Path: "SignCount", Value: int64(found.Authenticator.SignCount)},
+		{Path: "BackupState", Value: found.Flags.BackupState},
+		{Path: "LastUsedAt", Value: time.Now()},
+	})
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
@@ -0,0 +1,233 @@
+package passkey
+
+import (
+	"backend/apierror"
+	"backend/audit"
+	"backend/db"
+	"backend/model"
+	"backend/profile"
+	"backend/validation"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListHandler lists the logged-in user's passkeys
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	passkeys, err := listPasskeys(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve passkeys")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(passkeys)
+}
+
+// RegisterBeginHandler starts adding a passkey and returns the options for
+// navigator.credentials.create. Passkeys the user already has are excluded, so the same
+// authenticator isn't registered twice.
+func RegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.PasskeyBeginRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !profile.Reauthenticate(w, userID, request.CurrentPassword, request.EmailCode) {
+		return
+	}
+
+	rp, ok := relyingPartyOrError(w)
+	if !ok {
+		return
+	}
+	u, err := loadUser(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(u.passkeys))
+	for _, credential := range u.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	// The passkey must be discoverable, so it can log in without an email being typed,
+	// and must check the user's PIN or biometrics, since it replaces the password
+	creation, data, err := rp.BeginRegistration(u,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		log.Printf("Failed to begin passkey registration for %s: %v", userID, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to start passkey registration")
+		return
+	}
+	sessionID, err := saveSession(userID, purposeRegister, data)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to start passkey registration")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessionID": sessionID,
+		"options":   creation,
+	})
+}
+
+// RegisterFinishHandler checks the new passkey the browser created and saves it
+func RegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.PasskeyRegistrationRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+
+	rp, ok := relyingPartyOrError(w)
+	if !ok {
+		return
+	}
+	data, err := takeSession(request.SessionID, userID, purposeRegister)
+	if errors.Is(err, ErrSessionInvalid) {
+		apierror.Write(w, http.StatusBadRequest, apierror.PasskeySessionInvalid, "Passkey registration expired. Please start again.")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to read passkey session")
+		return
+	}
+	u, err := loadUser(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+
+	body, err := reencode(request.Credential)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidPasskey, "Invalid passkey credential")
+		return
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidPasskey, "Invalid passkey credential")
+		return
+	}
+	credential, err := rp.CreateCredential(u, *data, parsed)
+	if err != nil {
+		log.Printf("Passkey registration for %s failed: %v", userID, err)
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidPasskey, "The passkey could not be verified")
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+	passkey := model.Passkey{
+		ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(passkeysRef(userID).Doc(passkey.ID), passkey); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.PasskeyAdd)
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		apierror.Write(w, http.StatusConflict, apierror.Conflict, "This passkey is already registered")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to save passkey")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+// DeleteHandler removes one of the logged-in user's passkeys. The passkey itself stays
+// on the device, but can no longer log in.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	ref := passkeysRef(userID).Doc(r.PathValue("id"))
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); err != nil {
+			return err
+		}
+		if err := tx.Delete(ref); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.PasskeyRemove)
+	})
+	if status.Code(err) == codes.NotFound {
+		apierror.Write(w, http.StatusNotFound, apierror.PasskeyNotFound, "Passkey not found")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to remove passkey")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey removed"})
+}
+
+func relyingPartyOrError(w http.ResponseWriter) (*webauthn.WebAuthn, bool) {
+	rp, err := webAuthn()
+	if err != nil {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.InternalError, "Passkeys are not configured")
+		return nil, false
+	}
+	return rp, true
+}
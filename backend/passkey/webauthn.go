@@ -0,0 +1,256 @@
+// Package passkey lets users log in without a password using passkeys (WebAuthn).
+// A logged-in user registers a passkey with the register ceremony; afterwards the login
+// ceremony finds the account from the passkey alone, so no email has to be typed.
+//
+// Each ceremony has two steps. The first returns the options for the browser's
+// navigator.credentials call and a session ID; the second takes the browser's answer and
+// that session ID. Sessions hold the challenge, expire after five minutes and can be
+// used once.
+package passkey
+
+import (
+	"backend/db"
+	"backend/identity"
+	"backend/model"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// How long the browser has to answer a ceremony
+const sessionTimeout = 5 * time.Minute
+
+// Ceremony purposes, so a registration session can't finish a login or the other way round
+const (
+	purposeRegister = "register"
+	purposeLogin    = "login"
+)
+
+// ErrSessionInvalid is returned when a ceremony's session is unknown, used or expired
+var ErrSessionInvalid = errors.New("passkey session is invalid or expired")
+
+var (
+	loadOnce     sync.Once
+	relyingParty *webauthn.WebAuthn
+	loadErr      error
+)
+
+// session is the document stored at passkeySessions/{id} between the two steps of a ceremony
+type session struct {
+	UserID  string // Empty for logins, where the user isn't known until the passkey answers
+	Purpose string
+	Data    string // webauthn.SessionData as JSON
+	Expires time.Time
+}
+
+// loadRelyingParty configures WebAuthn from WEBAUTHN_RP_ID, the domain passkeys are
+// bound to, and WEBAUTHN_RP_ORIGINS, a comma-separated list of the origins the frontend
+// is served from. They default to the local development setup.
+func loadRelyingParty() {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		origins = []string{"http://localhost:3000"}
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: sessionTimeout, TimeoutUVD: sessionTimeout}
+	relyingParty, loadErr = webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "DailyVerse",
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if loadErr != nil {
+		log.Printf("Passkeys are not available: %v", loadErr)
+	}
+}
+
+func webAuthn() (*webauthn.WebAuthn, error) {
+	loadOnce.Do(loadRelyingParty)
+	return relyingParty, loadErr
+}
+
+// user adapts a user and their passkeys to webauthn.User. The user handle stored in
+// each passkey is the user ID, which is how a login finds the account.
+type user struct {
+	id       string
+	name     string
+	passkeys []model.Passkey
+}
+
+func (u *user) WebAuthnID() []byte          { return []byte(u.id) }
+func (u *user) WebAuthnName() string        { return u.name }
+func (u *user) WebAuthnDisplayName() string { return u.name }
+func (u *user) WebAuthnIcon() string        { return "" }
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(passkey.ID)
+		if err != nil {
+			continue
+		}
+		transports := make([]protocol.AuthenticatorTransport, len(passkey.Transports))
+		for i, transport := range passkey.Transports {
+			transports[i] = protocol.AuthenticatorTransport(transport)
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserVerified:   passkey.UserVerified,
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    passkey.AAGUID,
+				SignCount: uint32(passkey.SignCount),
+			},
+		})
+	}
+	return credentials
+}
+
+// loadUser reads a user and their passkeys
+func loadUser(userID string) (*user, error) {
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		return nil, err
+	}
+	var data model.User
+	if err := doc.DataTo(&data); err != nil {
+		return nil, err
+	}
+	passkeys, err := listPasskeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &user{id: userID, name: data.Email, passkeys: passkeys}, nil
+}
+
+// passkeysRef returns the collection holding a user's passkeys
+func passkeysRef(userID string) *firestore.CollectionRef {
+	return identity.UserRef(userID).Collection("passkeys")
+}
+
+func listPasskeys(userID string) ([]model.Passkey, error) {
+	docs, err := passkeysRef(userID).OrderBy("CreatedAt", firestore.Asc).Documents(db.Ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	passkeys := make([]model.Passkey, 0, len(docs))
+	for _, doc := range docs {
+		var passkey model.Passkey
+		if err := doc.DataTo(&passkey); err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, nil
+}
+
+// saveSession stores the state of a ceremony's first step and returns its ID
+func saveSession(userID, purpose string, data *webauthn.SessionData) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	sessionID := base64.RawURLEncoding.EncodeToString(random)
+	_, err = db.Client.Collection("passkeySessions").Doc(sessionID).Set(db.Ctx, session{
+		UserID:  userID,
+		Purpose: purpose,
+		Data:    string(raw),
+		Expires: time.Now().Add(sessionTimeout),
+	})
+	return sessionID, err
+}
+
+// takeSession reads and deletes a ceremony's session, so each challenge is answered once
+func takeSession(sessionID, userID, purpose string) (*webauthn.SessionData, error) {
+	ref := db.Client.Collection("passkeySessions").Doc(sessionID)
+	var stored session
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrSessionInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&stored); err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored.Purpose != purpose || stored.UserID != userID || time.Now().After(stored.Expires) {
+		return nil, ErrSessionInvalid
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(stored.Data), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// DeleteExpiredSessions removes the sessions of ceremonies that were never finished
+func DeleteExpiredSessions() {
+	iter := db.Client.Collection("passkeySessions").Where("Expires", "<=", time.Now()).Documents(db.Ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Printf("Error listing expired passkey sessions: %v", err)
+			return
+		}
+		if _, err := doc.Ref.Delete(db.Ctx); err != nil {
+			log.Printf("Failed to delete passkey session %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
+
+// reencode turns the credential object of a request body back into the JSON the
+// protocol parsers read
+func reencode(credential map[string]interface{}) (*bytes.Reader, error) {
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential: %v", err)
+	}
+	return bytes.NewReader(raw), nil
+}
@@ -0,0 +1,165 @@
+package profile
+
+import (
+	"backend/apierror"
+	"backend/audit"
+	"backend/db"
+	"backend/email"
+	"backend/identity"
+	"backend/model"
+	"backend/otp"
+	"backend/validation"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const emailChangeOTPLifetime = 10 * time.Minute
+
+// ChangeEmailHandler starts changing the account's email address. A code is sent to the
+// new address and the change happens once ConfirmEmailChangeHandler receives it.
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.EmailChangeRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !Reauthenticate(w, userID, request.CurrentPassword, request.EmailCode) {
+		return
+	}
+
+	_, err := identity.UserIDByEmail(request.NewEmail)
+	if err == nil {
+		apierror.Write(w, http.StatusConflict, apierror.EmailAlreadyRegistered, "Email already registered")
+		return
+	}
+	if status.Code(err) != codes.NotFound {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check if email exists")
+		return
+	}
+
+	otpCode, record, err := otp.New(otp.EmailChange, emailChangeOTPLifetime)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate OTP")
+		return
+	}
+	userRef := identity.UserRef(userID)
+	var lang string
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		lang = email.UserLanguage(doc)
+		if err := tx.Update(userRef, []firestore.Update{
+			{Path: "PendingEmail", Value: request.NewEmail},
+			{Path: "PendingEmailRequestedAt", Value: time.Now().UTC()},
+			{Path: otp.Field(otp.EmailChange), Value: record},
+		}); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.EmailChangeRequested)
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to request email change")
+		return
+	}
+
+	err = email.Send(request.NewEmail, lang, "email_change_code", map[string]interface{}{
+		"Code":    otpCode,
+		"Minutes": int(emailChangeOTPLifetime.Minutes()),
+	})
+	if err != nil {
+		log.Printf("Failed to send email change code: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send OTP email")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "A verification code has been sent to the new email address.",
+	})
+}
+
+// ConfirmEmailChangeHandler checks the code sent to the pending address and makes it the
+// account's email. Only the user document and the emails index change, since everything
+// else refers to the user by ID. The old address is told about the change.
+func ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.EmailChangeConfirmRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+
+	userRef := identity.UserRef(userID)
+	doc, err := userRef.Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	var user model.User
+	if err := doc.DataTo(&user); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse user data")
+		return
+	}
+	if user.PendingEmail == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidRequest, "No email change is pending")
+		return
+	}
+	if !otp.Check(w, userRef, otp.EmailChange, request.OTP) {
+		return
+	}
+
+	oldEmail, newEmail := user.Email, user.PendingEmail
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// Reserve fails if the new address got registered since the request
+		if err := identity.Reserve(tx, newEmail, userID); err != nil {
+			return err
+		}
+		if err := identity.Release(tx, oldEmail); err != nil {
+			return err
+		}
+		if err := tx.Update(userRef, []firestore.Update{
+			{Path: "Email", Value: newEmail},
+			{Path: "PendingEmail", Value: firestore.Delete},
+			{Path: "PendingEmailRequestedAt", Value: firestore.Delete},
+		}); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.EmailChange)
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		apierror.Write(w, http.StatusConflict, apierror.EmailAlreadyRegistered, "Email already registered")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to change email of user %s: %v", userID, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to change email")
+		return
+	}
+
+	err = email.Send(oldEmail, user.Language, "email_changed", map[string]interface{}{"NewEmail": newEmail})
+	if err != nil {
+		log.Printf("Failed to notify %s of the email change: %v", oldEmail, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email changed successfully"})
+}
@@ -1,92 +1,166 @@
 package profile
 
 import (
+	"backend/apierror"
+	"backend/audit"
 	"backend/db"
 	"backend/function"
+	"backend/model"
+	"backend/validation"
+	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"cloud.google.com/go/firestore"
 )
 
-func ProfileHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		GetProfileHandler(w, r)
-	case "PUT":
-		UpdateProfileHandler(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
 func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
-	userEmail, ok := r.Context().Value("userEmail").(string)
+	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "User email not found in context", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
-	doc, err := db.Client.Collection("users").Doc(userEmail).Get(db.Ctx)
+	doc, err := db.Client.Collection("users").Doc(userID).Get(db.Ctx)
 	if err != nil {
-		http.Error(w, "Failed to get profile", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to get profile")
 		return
 	}
 
-	var profileData map[string]interface{}
-	doc.DataTo(&profileData)
+	var user model.User
+	if err := doc.DataTo(&user); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to parse profile")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(profileData)
+	json.NewEncoder(w).Encode(model.Profile{
+		Username:    user.Username,
+		Email:       user.Email,
+		Country:     user.Country,
+		CountryCode: user.CountryCode,
+		City:        user.City,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		ImageURL:    user.ImageURL,
+		Language:    user.Language,
+	})
 }
 
+// UpdateProfileHandler changes the profile fields in the request. Only the fields of
+// model.ProfileUpdate can be set; password and email have their own endpoints.
 func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
-	userEmail, ok := r.Context().Value("userEmail").(string)
+	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "User email not found in context", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
 		return
 	}
 
-	var updatedData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var update model.ProfileUpdate
+	if !validation.DecodeJSON(w, r, &update) {
 		return
 	}
 
-	doc, err := db.Client.Collection("users").Doc(userEmail).Get(db.Ctx)
-	if err != nil {
-		http.Error(w, "Failed to retrieve user data", http.StatusInternalServerError)
+	// Values are stored trimmed, so a username of only spaces would be empty
+	if update.Username != nil && strings.TrimSpace(*update.Username) == "" {
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.ValidationFailed, "Some fields are invalid",
+			[]apierror.FieldError{{Field: "username", Message: "must not be blank"}})
 		return
 	}
-	userData := doc.Data()
-	storedHashedPassword := userData["Password"].(string)
 
-	// Ensure the current password is provided for all updates
-	currentPassword, ok := updatedData["CurrentPassword"].(string)
-	if !ok || function.HashPassword(currentPassword) != storedHashedPassword {
-		http.Error(w, "Invalid current password", http.StatusUnauthorized)
+	var updates []firestore.Update
+	var fields []string
+	set := func(path string, value *string) {
+		if value != nil {
+			updates = append(updates, firestore.Update{Path: path, Value: strings.TrimSpace(*value)})
+			fields = append(fields, path)
+		}
+	}
+	set("Username", update.Username)
+	set("Country", update.Country)
+	set("CountryCode", update.CountryCode)
+	set("City", update.City)
+	set("FirstName", update.FirstName)
+	set("LastName", update.LastName)
+	set("ImageURL", update.ImageURL)
+	set("Language", update.Language)
+	if len(updates) == 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.ValidationFailed, "No profile fields to update")
 		return
 	}
+	if update.Username != nil {
+		// Keep the lowercase copy used by user search in step with the username
+		updates = append(updates, firestore.Update{Path: "UsernameLower", Value: strings.ToLower(strings.TrimSpace(*update.Username))})
+	}
 
-	// Update password if new password is provided
-	if newPassword, ok := updatedData["NewPassword"].(string); ok && newPassword != "" {
-		if !function.IsValidPassword(newPassword) {
-			http.Error(w, "Password does not meet complexity requirements", http.StatusBadRequest)
-			return
+	userRef := db.Client.Collection("users").Doc(userID)
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(userRef, updates); err != nil {
+			return err
 		}
-		updatedData["Password"] = function.HashPassword(newPassword)
+		return audit.Add(tx, r, userID, audit.ProfileUpdate, fields...)
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update profile")
+		return
 	}
 
-	delete(updatedData, "CurrentPassword")
-	delete(updatedData, "NewPassword")
-	delete(updatedData, "Email") // Prevent email from being updated
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully updated profile"})
+}
 
-	_, err = db.Client.Collection("users").Doc(userEmail).Set(db.Ctx, updatedData, firestore.MergeAll)
+// ChangePasswordHandler sets a new password after checking the current one
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.PasswordChangeRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+	if !CheckPassword(w, userID, request.CurrentPassword) {
+		return
+	}
+	if !function.IsValidPassword(request.NewPassword) {
+		apierror.Write(w, http.StatusBadRequest, apierror.WeakPassword, "Password must be at least 8 characters long, contain at least one uppercase letter, one digit, and one special character")
+		return
+	}
+
+	userRef := db.Client.Collection("users").Doc(userID)
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(userRef, []firestore.Update{
+			{Path: "Password", Value: function.HashPassword(request.NewPassword)},
+		}); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, userID, audit.PasswordChange)
+	})
 	if err != nil {
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to change password")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully updated profile"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"})
+}
+
+// CheckPassword compares password with the user's stored password and writes a 401 if
+// it doesn't match
+func CheckPassword(w http.ResponseWriter, userID, password string) bool {
+	doc, err := db.Client.Collection("users").Doc(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return false
+	}
+
+	storedHashedPassword, _ := doc.Data()["Password"].(string)
+	if storedHashedPassword == "" || function.HashPassword(password) != storedHashedPassword {
+		apierror.Write(w, http.StatusUnauthorized, apierror.InvalidCredentials, "Invalid current password")
+		return false
+	}
+	return true
 }
@@ -0,0 +1,83 @@
+package profile
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/email"
+	"backend/function"
+	"backend/identity"
+	"backend/otp"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const reauthOTPLifetime = 10 * time.Minute
+
+// ReauthCodeHandler emails a code that stands in for the password when a user without
+// one, such as an account made through OpenID Connect login, deletes the account or
+// changes how they log in
+func ReauthCodeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	if password, _ := doc.Data()["Password"].(string); password != "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidRequest, "This account has a password; confirm with it instead")
+		return
+	}
+	address, _ := doc.Data()["Email"].(string)
+
+	code, err := otp.Issue(doc.Ref, otp.Reauth, reauthOTPLifetime)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate OTP")
+		return
+	}
+	err = email.Send(address, email.UserLanguage(doc), "reauth_code", map[string]interface{}{
+		"Code":    code,
+		"Minutes": int(reauthOTPLifetime.Minutes()),
+	})
+	if err != nil {
+		log.Printf("Failed to send reauthentication code: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send OTP email")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "A code has been sent to your email address.",
+	})
+}
+
+// Reauthenticate checks that the logged-in user is the account holder before a
+// sensitive change. Accounts with a password confirm with it; accounts without one
+// confirm with a code from ReauthCodeHandler. Writes a 401 and returns false otherwise.
+func Reauthenticate(w http.ResponseWriter, userID, password, emailCode string) bool {
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return false
+	}
+
+	if storedHashedPassword, _ := doc.Data()["Password"].(string); storedHashedPassword != "" {
+		if password == "" || function.HashPassword(password) != storedHashedPassword {
+			apierror.Write(w, http.StatusUnauthorized, apierror.InvalidCredentials, "Invalid current password")
+			return false
+		}
+		return true
+	}
+
+	if emailCode == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.ReauthCodeRequired, "This account has no password. Request a code with POST /api/v1/profile/reauth-code and send it as emailCode.")
+		return false
+	}
+	return otp.Check(w, doc.Ref, otp.Reauth, emailCode)
+}
@@ -0,0 +1,302 @@
+package router
+
+import (
+	"backend/account"
+	"backend/apierror"
+	"backend/city"
+	"backend/country"
+	"backend/email"
+	"backend/event"
+	"backend/friend"
+	"backend/journal"
+	"backend/mfa"
+	"backend/middleware"
+	"backend/news"
+	"backend/openapi"
+	"backend/passkey"
+	"backend/profile"
+	"backend/user"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Prefix of the versioned API
+const apiV1 = "/api/v1"
+
+// route is one /api/v1 operation: its documentation, the middleware it needs and its handler
+type route struct {
+	openapi.Route
+	rateLimit middleware.Limit // zero for routes without a rate limit
+	mfaStep   bool             // takes the token from the password step of a two-factor login instead
+	handler   http.HandlerFunc
+}
+
+// v1Routes lists every /api/v1 operation. The OpenAPI spec is generated from this table;
+// handlers decode and validate their own bodies with validation.DecodeJSON, against the
+// same validate tags the route's body and parameter schemas are built from.
+func v1Routes() []route {
+	return []route{
+		// Users and authentication
+		{Route: openapi.Route{Pattern: "POST /auth/signup", Summary: "Register and send a verification code", Tag: "Auth", Body: signupSchema}, rateLimit: middleware.SignupLimit, handler: user.UserSignup},
+		{Route: openapi.Route{Pattern: "POST /auth/login", Summary: "Log in and get a token", Tag: "Auth", Body: loginSchema}, rateLimit: middleware.AuthLimit, handler: user.UserLogin},
+		{Route: openapi.Route{Pattern: "POST /auth/login/2fa", Summary: "Finish a two-factor login with a code", Tag: "Auth", Auth: true, Body: mfaCodeSchema}, rateLimit: middleware.AuthLimit, mfaStep: true, handler: user.UserLoginMFA},
+		{Route: openapi.Route{Pattern: "POST /auth/passkey/begin", Summary: "Start a passkey login", Tag: "Auth"}, rateLimit: middleware.AuthLimit, handler: user.UserLoginPasskeyBegin},
+		{Route: openapi.Route{Pattern: "POST /auth/passkey/finish", Summary: "Finish a passkey login and get a token", Tag: "Auth", Body: passkeyLoginSchema}, rateLimit: middleware.AuthLimit, handler: user.UserLoginPasskey},
+		{Route: openapi.Route{Pattern: "GET /auth/oidc/providers", Summary: "List the OpenID Connect login providers", Tag: "Auth"}, handler: user.OIDCProviders},
+		{Route: openapi.Route{Pattern: "POST /auth/oidc/{provider}/begin", Summary: "Start a login with an OpenID Connect provider", Tag: "Auth"}, rateLimit: middleware.AuthLimit, handler: user.UserLoginOIDCBegin},
+		{Route: openapi.Route{Pattern: "POST /auth/oidc/finish", Summary: "Finish a provider login and get a token", Tag: "Auth", Body: oidcLoginSchema}, rateLimit: middleware.AuthLimit, handler: user.UserLoginOIDC},
+		{Route: openapi.Route{Pattern: "POST /auth/login/link", Summary: "Email a passwordless login link", Tag: "Auth", Body: emailSchema}, rateLimit: middleware.EmailLimit, handler: user.UserLoginLinkRequest},
+		{Route: openapi.Route{Pattern: "POST /auth/login/link/finish", Summary: "Log in with the token from a login link", Tag: "Auth", Body: linkSchema}, rateLimit: middleware.AuthLimit, handler: user.UserLoginLink},
+		{Route: openapi.Route{Pattern: "POST /auth/resend-otp", Summary: "Send a new verification code", Tag: "Auth", Body: emailSchema}, rateLimit: middleware.EmailLimit, handler: user.ResendOTP},
+		{Route: openapi.Route{Pattern: "POST /auth/verify-email", Summary: "Verify an email address with its code", Tag: "Auth", Body: verifyEmailSchema}, rateLimit: middleware.AuthLimit, handler: email.VerifyEmail},
+		{Route: openapi.Route{Pattern: "POST /auth/verify-email/link", Summary: "Verify an email address with the token from its link", Tag: "Auth", Body: linkSchema}, rateLimit: middleware.AuthLimit, handler: email.VerifyEmailLink},
+		{Route: openapi.Route{Pattern: "POST /auth/forgot-password", Summary: "Email a password reset code", Tag: "Auth", Body: emailSchema}, rateLimit: middleware.EmailLimit, handler: user.ForgotPassword},
+		{Route: openapi.Route{Pattern: "POST /auth/reset-password", Summary: "Set a new password with a reset code", Tag: "Auth", Body: resetPasswordSchema}, rateLimit: middleware.AuthLimit, handler: user.ResetPassword},
+		{Route: openapi.Route{Pattern: "POST /auth/reset-password/link", Summary: "Set a new password with the token from a reset link", Tag: "Auth", Body: linkResetPasswordSchema}, rateLimit: middleware.AuthLimit, handler: user.ResetPasswordLink},
+		{Route: openapi.Route{Pattern: "GET /me", Summary: "Get the logged-in user", Tag: "Users", Auth: true}, handler: user.GetUserInfo},
+		{Route: openapi.Route{Pattern: "GET /users/search", Summary: "Search users by username", Tag: "Users", Auth: true, Params: userSearchParamsSchema}, handler: user.SearchUsersByUsername},
+		{Route: openapi.Route{Pattern: "GET /profile", Summary: "Get the logged-in user's profile", Tag: "Users", Auth: true}, handler: profile.GetProfileHandler},
+		{Route: openapi.Route{Pattern: "PUT /profile", Summary: "Update the logged-in user's profile", Tag: "Users", Auth: true, Body: profileSchema}, handler: profile.UpdateProfileHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/reauth-code", Summary: "Email a code that confirms changes to an account without a password", Tag: "Users", Auth: true}, rateLimit: middleware.EmailLimit, handler: profile.ReauthCodeHandler},
+		{Route: openapi.Route{Pattern: "PUT /profile/password", Summary: "Change the logged-in user's password", Tag: "Users", Auth: true, Body: passwordChangeSchema}, handler: profile.ChangePasswordHandler},
+		{Route: openapi.Route{Pattern: "PUT /profile/email", Summary: "Send a code to a new email address", Tag: "Users", Auth: true, Body: emailChangeSchema}, rateLimit: middleware.EmailLimit, handler: profile.ChangeEmailHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/email/confirm", Summary: "Confirm the new email address with its code", Tag: "Users", Auth: true, Body: emailChangeConfirmSchema}, rateLimit: middleware.AccountLimit, handler: profile.ConfirmEmailChangeHandler},
+		{Route: openapi.Route{Pattern: "GET /profile/2fa", Summary: "Get the two-factor authentication status", Tag: "Users", Auth: true}, handler: mfa.StatusHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/2fa/setup", Summary: "Create a secret for an authenticator app", Tag: "Users", Auth: true, Body: mfaSetupSchema}, rateLimit: middleware.AccountLimit, handler: mfa.SetupHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/2fa/enable", Summary: "Turn on two-factor authentication and get recovery codes", Tag: "Users", Auth: true, Body: mfaCodeSchema}, rateLimit: middleware.AccountLimit, handler: mfa.EnableHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/2fa/disable", Summary: "Turn off two-factor authentication", Tag: "Users", Auth: true, Body: mfaDisableSchema}, rateLimit: middleware.AccountLimit, handler: mfa.DisableHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/2fa/recovery-codes", Summary: "Replace the recovery codes", Tag: "Users", Auth: true, Body: mfaCodeSchema}, rateLimit: middleware.AccountLimit, handler: mfa.RecoveryCodesHandler},
+		{Route: openapi.Route{Pattern: "GET /profile/passkeys", Summary: "List the logged-in user's passkeys", Tag: "Users", Auth: true}, handler: passkey.ListHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/passkeys/begin", Summary: "Start adding a passkey", Tag: "Users", Auth: true, Body: passkeyBeginSchema}, rateLimit: middleware.AccountLimit, handler: passkey.RegisterBeginHandler},
+		{Route: openapi.Route{Pattern: "POST /profile/passkeys/finish", Summary: "Finish adding a passkey", Tag: "Users", Auth: true, Body: passkeyRegistrationSchema}, rateLimit: middleware.AccountLimit, handler: passkey.RegisterFinishHandler},
+		{Route: openapi.Route{Pattern: "DELETE /profile/passkeys/{id}", Summary: "Remove a passkey", Tag: "Users", Auth: true}, handler: passkey.DeleteHandler},
+		{Route: openapi.Route{Pattern: "GET /account/export", Summary: "Download all of the logged-in user's data", Tag: "Users", Auth: true, Params: accountExportParamsSchema}, handler: account.ExportHandler},
+		{Route: openapi.Route{Pattern: "POST /account/delete", Summary: "Delete the logged-in user's account and data", Tag: "Users", Auth: true, Body: accountDeleteSchema}, rateLimit: middleware.AccountLimit, handler: account.DeleteHandler},
+
+		// Events
+		{Route: openapi.Route{Pattern: "GET /events", Summary: "List own events and friends' public events", Tag: "Events", Auth: true}, handler: event.GetAllEventsHandler},
+		{Route: openapi.Route{Pattern: "POST /events", Summary: "Create an event", Tag: "Events", Auth: true, Body: eventSchema}, handler: event.CreateEventHandler},
+		{Route: openapi.Route{Pattern: "POST /events/import/ntnu", Summary: "Import an NTNU timetable from an ICS file or URL", Tag: "Events", Auth: true, Params: eventImportParamsSchema}, handler: event.NTNUTimetableImportHandler},
+		{Route: openapi.Route{Pattern: "GET /events/{id}", Summary: "Get an event", Tag: "Events", Auth: true}, handler: pathQuery(event.GetEventHandler, "id", "eventID")},
+		{Route: openapi.Route{Pattern: "PUT /events/{id}", Summary: "Update an event", Tag: "Events", Auth: true, Body: eventSchema}, handler: pathQuery(event.UpdateEventHandler, "id", "eventID")},
+		{Route: openapi.Route{Pattern: "DELETE /events/{id}", Summary: "Delete an event", Tag: "Events", Auth: true}, handler: pathQuery(event.DeleteEventHandler, "id", "eventID")},
+
+		// Friends
+		{Route: openapi.Route{Pattern: "GET /friends", Summary: "List friends", Tag: "Friends", Auth: true}, handler: friend.GetFriendsList},
+		{Route: openapi.Route{Pattern: "DELETE /friends/{username}", Summary: "Remove a friend", Tag: "Friends", Auth: true}, handler: usernameBody(friend.RemoveFriend)},
+		{Route: openapi.Route{Pattern: "GET /friends/requests", Summary: "List pending friend requests", Tag: "Friends", Auth: true}, handler: friend.GetPendingFriendRequests},
+		{Route: openapi.Route{Pattern: "POST /friends/requests", Summary: "Send a friend request", Tag: "Friends", Auth: true, Body: usernameSchema}, handler: friend.SendFriendRequestByUsername},
+		{Route: openapi.Route{Pattern: "DELETE /friends/requests/{username}", Summary: "Cancel a sent friend request", Tag: "Friends", Auth: true}, handler: usernameBody(friend.CancelFriendRequest)},
+		{Route: openapi.Route{Pattern: "POST /friends/requests/{username}/accept", Summary: "Accept a friend request", Tag: "Friends", Auth: true}, handler: usernameBody(friend.AcceptFriendRequestByUsername)},
+		{Route: openapi.Route{Pattern: "POST /friends/requests/{username}/decline", Summary: "Decline a friend request", Tag: "Friends", Auth: true}, handler: usernameBody(friend.DeclineFriendRequestByUsername)},
+
+		// Lookups
+		{Route: openapi.Route{Pattern: "GET /countries", Summary: "Search countries", Tag: "Lookups", Params: countryParamsSchema}, handler: country.GetCountries},
+		{Route: openapi.Route{Pattern: "GET /cities", Summary: "List the cities of a country", Tag: "Lookups", Params: cityParamsSchema}, handler: city.GetCities},
+		{Route: openapi.Route{Pattern: "GET /news", Summary: "Get news for the user's country", Tag: "News", Auth: true, Params: newsParamsSchema}, handler: news.FetchNewsHandler},
+
+		// Journals
+		{Route: openapi.Route{Pattern: "GET /journals", Summary: "List journal entries", Tag: "Journals", Auth: true, Params: journalFilterParamsSchema}, handler: journal.GetAllJournalsHandler},
+		{Route: openapi.Route{Pattern: "POST /journals", Summary: "Create a journal entry", Tag: "Journals", Auth: true, Params: journalCreateParamsSchema, Body: journalSchema}, handler: journal.CreateJournalHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/search", Summary: "Search journal entries", Tag: "Journals", Auth: true, Params: journalSearchParamsSchema}, handler: journal.SearchJournalsHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/stats", Summary: "Get writing streaks and mood statistics", Tag: "Journals", Auth: true, Params: journalStatsParamsSchema}, handler: journal.GetJournalStatsHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/export", Summary: "Export all journal entries", Tag: "Journals", Auth: true, Params: journalExportParamsSchema}, handler: journal.ExportJournalsHandler},
+		{Route: openapi.Route{Pattern: "POST /journals/import", Summary: "Import journal entries from Markdown or Day One", Tag: "Journals", Auth: true, Params: journalImportParamsSchema, FileField: "file"}, handler: journal.ImportJournalsHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/shared", Summary: "List entries friends have shared", Tag: "Journals", Auth: true}, handler: journal.GetSharedJournalsHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/prompt", Summary: "Get the writing prompt of the day", Tag: "Journals", Auth: true, Params: journalPromptParamsSchema}, handler: journal.GetJournalPromptHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/reminder", Summary: "Get the daily reminder setting", Tag: "Journals", Auth: true}, handler: journal.GetReminderHandler},
+		{Route: openapi.Route{Pattern: "PUT /journals/reminder", Summary: "Change the daily reminder setting", Tag: "Journals", Auth: true, Body: reminderSchema}, handler: journal.UpdateReminderHandler},
+		{Route: openapi.Route{Pattern: "GET /journals/{id}", Summary: "Get a journal entry, own or shared by a friend", Tag: "Journals", Auth: true, Params: journalParamsSchema}, handler: pathQuery(journal.GetJournalHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "PUT /journals/{id}", Summary: "Update a journal entry", Tag: "Journals", Auth: true, Body: journalSchema}, handler: pathQuery(journal.UpdateJournalHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "DELETE /journals/{id}", Summary: "Delete a journal entry", Tag: "Journals", Auth: true}, handler: pathQuery(journal.DeleteJournalHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "POST /journals/{id}/share", Summary: "Share an entry with friends", Tag: "Journals", Auth: true, Body: usernamesSchema}, handler: pathQuery(journal.ShareJournalHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "POST /journals/{id}/unshare", Summary: "Stop sharing an entry", Tag: "Journals", Auth: true, Body: usernamesSchema}, handler: pathQuery(journal.UnshareJournalHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "GET /journals/{id}/revisions", Summary: "List earlier versions of an entry", Tag: "Journals", Auth: true}, handler: pathQuery(journal.GetJournalRevisionsHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "GET /journals/{id}/revisions/diff", Summary: "Compare two versions of an entry", Tag: "Journals", Auth: true, Params: revisionDiffParamsSchema}, handler: pathQuery(journal.DiffJournalRevisionsHandler, "id", "journalID")},
+		{Route: openapi.Route{Pattern: "POST /journals/{id}/revisions/{revisionID}/restore", Summary: "Restore an earlier version of an entry", Tag: "Journals", Auth: true}, handler: pathQuery(journal.RestoreJournalRevisionHandler, "id", "journalID", "revisionID", "revisionID")},
+		{Route: openapi.Route{Pattern: "GET /journal-days/{date}", Summary: "Get the entry and sections for a day", Tag: "Journals", Auth: true, Params: journalDayParamsSchema}, handler: journal.GetJournalByDateHandler},
+		{Route: openapi.Route{Pattern: "PUT /journal-days/{date}", Summary: "Create or replace the entry for a day", Tag: "Journals", Auth: true, Params: journalDaySectionParamsSchema, Body: journalDaySchema}, handler: journal.UpsertJournalByDateHandler},
+	}
+}
+
+// New returns the API handler with every route registered. Routes are Go 1.22 patterns
+// ("METHOD /path/{param}"); requests with the wrong method get 405 and an Allow header
+// listing the methods the path supports.
+//
+// Each API version has its own prefix and route table; a breaking change goes into a
+// new /api/v2 table while /api/v1 keeps working.
+func New() http.Handler {
+	mux := http.NewServeMux()
+
+	routes := v1Routes()
+	docs := make([]openapi.Route, len(routes))
+	for i, rt := range routes {
+		mux.Handle(v1(rt.Pattern), rt.build())
+		docs[i] = rt.Route
+	}
+	mux.Handle("GET /api/openapi.json", openapi.Handler(openapi.Build("DailyVerse API", "1.0.0", apiV1, docs)))
+
+	registerLegacy(mux)
+
+	// Email previews for working on the templates; off in production
+	if os.Getenv("EMAIL_PREVIEW") == "true" {
+		mux.HandleFunc("GET /dev/emails", email.PreviewListHandler)
+		mux.HandleFunc("GET /dev/emails/{name}", email.PreviewHandler)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			notMatched(mux, w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// notMatched answers requests no route matches with a JSON error instead of the mux's
+// plain-text one: 405 if the path exists for other methods, 404 otherwise
+func notMatched(mux *http.ServeMux, w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+
+	if len(allowed) == 0 {
+		apierror.Write(w, http.StatusNotFound, apierror.RouteNotFound, "No route for "+r.URL.Path)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	apierror.Write(w, http.StatusMethodNotAllowed, apierror.MethodNotAllowed, "Method "+r.Method+" is not allowed here")
+}
+
+// build wraps the route's handler in authentication and rate limiting. The limit is
+// checked after authentication, so logged-in users are limited by user, not address.
+func (rt route) build() http.Handler {
+	handler := rt.handler
+	if rt.rateLimit.Name != "" {
+		handler = middleware.RateLimit(rt.rateLimit, handler).ServeHTTP
+	}
+	switch {
+	case rt.mfaStep:
+		return middleware.MFAPendingMiddleware(handler)
+	case rt.Auth:
+		return auth(handler)
+	}
+	return handler
+}
+
+// registerLegacy keeps the routes the app used before /api/v1 working. They are
+// deprecated: responses carry a Deprecation header and a Link to the replacement.
+func registerLegacy(mux *http.ServeMux) {
+	handle := func(pattern, successor string, h http.Handler) {
+		mux.Handle(pattern, deprecated(h, successor))
+	}
+
+	// User routes
+	handle("POST /api/signup", v1("/auth/signup"), middleware.RateLimit(middleware.SignupLimit, http.HandlerFunc(user.UserSignup)))
+	handle("POST /api/login", v1("/auth/login"), middleware.RateLimit(middleware.AuthLimit, http.HandlerFunc(user.UserLogin)))
+	handle("POST /api/resend-otp", v1("/auth/resend-otp"), middleware.RateLimit(middleware.EmailLimit, http.HandlerFunc(user.ResendOTP)))
+	handle("POST /api/verify-email", v1("/auth/verify-email"), middleware.RateLimit(middleware.AuthLimit, http.HandlerFunc(email.VerifyEmail)))
+	handle("POST /api/forgot-password", v1("/auth/forgot-password"), middleware.RateLimit(middleware.EmailLimit, http.HandlerFunc(user.ForgotPassword)))
+	handle("POST /api/reset-password", v1("/auth/reset-password"), middleware.RateLimit(middleware.AuthLimit, http.HandlerFunc(user.ResetPassword)))
+	handle("GET /api/me", v1("/me"), auth(user.GetUserInfo))
+
+	// Event routes
+	handle("POST /api/events/create", v1("/events"), auth(event.CreateEventHandler))
+	handle("GET /api/events/get", v1("/events/{id}"), auth(event.GetEventHandler))
+	handle("PUT /api/events/update", v1("/events/{id}"), auth(event.UpdateEventHandler))
+	handle("DELETE /api/events/delete", v1("/events/{id}"), auth(event.DeleteEventHandler))
+	handle("GET /api/events/all", v1("/events"), auth(event.GetAllEventsHandler))
+	handle("POST /api/import-ntnu-timetable", v1("/events/import/ntnu"), auth(event.NTNUTimetableImportHandler))
+
+	// Friend routes using username
+	handle("POST /api/friends/add", v1("/friends/requests"), auth(friend.SendFriendRequestByUsername))
+	handle("POST /api/friends/accept", v1("/friends/requests/{username}/accept"), auth(friend.AcceptFriendRequestByUsername))
+	handle("GET /api/friends/list", v1("/friends"), auth(friend.GetFriendsList))
+	handle("POST /api/friends/delete", v1("/friends/{username}"), auth(friend.RemoveFriend))
+	handle("GET /api/friends/requests", v1("/friends/requests"), auth(friend.GetPendingFriendRequests))
+	handle("POST /api/friends/decline", v1("/friends/requests/{username}/decline"), auth(friend.DeclineFriendRequestByUsername))
+	handle("POST /api/friends/cancel", v1("/friends/requests/{username}"), auth(friend.CancelFriendRequest))
+	handle("GET /api/users/search", v1("/users/search"), auth(user.SearchUsersByUsername))
+
+	handle("GET /api/profile", v1("/profile"), auth(profile.GetProfileHandler))
+	handle("PUT /api/profile", v1("/profile"), auth(profile.UpdateProfileHandler))
+	handle("GET /api/countries", v1("/countries"), http.HandlerFunc(country.GetCountries))
+	handle("GET /api/cities", v1("/cities"), http.HandlerFunc(city.GetCities))
+	handle("GET /api/news", v1("/news"), auth(news.FetchNewsHandler))
+
+	// Journal routes
+	handle("POST /api/journal/save", v1("/journals"), auth(journal.CreateJournalHandler))
+	handle("GET /api/journal/{$}", v1("/journals/{id}"), auth(journal.GetJournalHandler))
+	handle("GET /api/journal/{date}", v1("/journal-days/{date}"), auth(journal.GetJournalByDateHandler))
+	handle("PUT /api/journal/{date}", v1("/journal-days/{date}"), auth(journal.UpsertJournalByDateHandler))
+	handle("PUT /api/journal/update/", v1("/journals/{id}"), auth(journal.UpdateJournalHandler))
+	handle("DELETE /api/journal/delete/", v1("/journals/{id}"), auth(journal.DeleteJournalHandler))
+	handle("GET /api/journals/", v1("/journals"), auth(journal.GetAllJournalsHandler))
+	handle("GET /api/journal/revisions", v1("/journals/{id}/revisions"), auth(journal.GetJournalRevisionsHandler))
+	handle("GET /api/journal/revisions/diff", v1("/journals/{id}/revisions/diff"), auth(journal.DiffJournalRevisionsHandler))
+	handle("POST /api/journal/revisions/restore", v1("/journals/{id}/revisions/{revisionID}/restore"), auth(journal.RestoreJournalRevisionHandler))
+	handle("GET /api/journal/prompt", v1("/journals/prompt"), auth(journal.GetJournalPromptHandler))
+	handle("GET /api/journal/reminder", v1("/journals/reminder"), auth(journal.GetReminderHandler))
+	handle("PUT /api/journal/reminder", v1("/journals/reminder"), auth(journal.UpdateReminderHandler))
+	handle("POST /api/journal/share", v1("/journals/{id}/share"), auth(journal.ShareJournalHandler))
+	handle("POST /api/journal/unshare", v1("/journals/{id}/unshare"), auth(journal.UnshareJournalHandler))
+	handle("GET /api/journals/shared", v1("/journals/shared"), auth(journal.GetSharedJournalsHandler))
+	handle("GET /api/journals/stats", v1("/journals/stats"), auth(journal.GetJournalStatsHandler))
+	handle("GET /api/journals/export", v1("/journals/export"), auth(journal.ExportJournalsHandler))
+	handle("POST /api/journals/import", v1("/journals/import"), auth(journal.ImportJournalsHandler))
+	handle("GET /api/journals/search", v1("/journals/search"), auth(journal.SearchJournalsHandler))
+}
+
+// v1 prefixes a route ("/events" or "GET /events") with /api/v1
+func v1(pattern string) string {
+	if method, path, found := strings.Cut(pattern, " "); found {
+		return method + " " + apiV1 + path
+	}
+	return apiV1 + pattern
+}
+
+// auth requires a valid JWT and puts the user's ID in the request context
+func auth(h http.HandlerFunc) http.Handler {
+	return middleware.JwtAuthMiddleware(h)
+}
+
+// deprecated marks responses from a legacy route and points clients to its successor
+func deprecated(h http.Handler, successor string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// pathQuery copies path values into the query parameters the handler reads, given as
+// pairs of path name and query name, e.g. pathQuery(h, "id", "eventID")
+func pathQuery(h http.HandlerFunc, names ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		for i := 0; i+1 < len(names); i += 2 {
+			query.Set(names[i+1], r.PathValue(names[i]))
+		}
+		r.URL.RawQuery = query.Encode()
+		h(w, r)
+	}
+}
+
+// usernameBody passes the {username} path value to friend handlers that read it from
+// a {"username": ...} request body
+func usernameBody(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := json.Marshal(map[string]string{"username": r.PathValue("username")})
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		h(w, r)
+	}
+}
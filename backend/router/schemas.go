@@ -0,0 +1,134 @@
+package router
+
+import (
+	"backend/model"
+	"backend/openapi"
+)
+
+// Request body schemas of the /api/v1 routes, published in the OpenAPI spec. Most are
+// derived from the validate tags of the types the handlers decode into.
+var (
+	emailSchema         = openapi.SchemaOf(model.EmailRequest{})
+	loginSchema         = openapi.SchemaOf(model.LoginRequest{})
+	signupSchema        = openapi.SchemaOf(model.SignupRequest{})
+	verifyEmailSchema   = openapi.SchemaOf(model.VerifyEmailRequest{})
+	resetPasswordSchema = openapi.SchemaOf(model.ResetPasswordRequest{})
+	eventSchema         = openapi.SchemaOf(model.Event{})
+	usernameSchema      = openapi.SchemaOf(model.UsernameRequest{})
+	usernamesSchema     = openapi.SchemaOf(model.UsernamesRequest{})
+	reminderSchema      = openapi.SchemaOf(model.JournalReminder{})
+
+	// Entries by ID need a date in the body; entries by day take it from the path
+	journalSchema    = openapi.SchemaOf(model.Journal{}).Require("date")
+	journalDaySchema = openapi.SchemaOf(model.Journal{})
+
+	profileSchema        = openapi.SchemaOf(model.ProfileUpdate{})
+	passwordChangeSchema = openapi.SchemaOf(model.PasswordChangeRequest{})
+	emailChangeSchema    = openapi.SchemaOf(model.EmailChangeRequest{})
+
+	emailChangeConfirmSchema = openapi.SchemaOf(model.EmailChangeConfirmRequest{})
+	accountDeleteSchema      = openapi.SchemaOf(model.AccountDeleteRequest{})
+
+	mfaSetupSchema   = openapi.SchemaOf(model.MFASetupRequest{})
+	mfaCodeSchema    = openapi.SchemaOf(model.MFACodeRequest{})
+	mfaDisableSchema = openapi.SchemaOf(model.MFADisableRequest{})
+
+	passkeyBeginSchema        = openapi.SchemaOf(model.PasskeyBeginRequest{})
+	passkeyRegistrationSchema = openapi.SchemaOf(model.PasskeyRegistrationRequest{})
+	passkeyLoginSchema        = openapi.SchemaOf(model.PasskeyLoginRequest{})
+	oidcLoginSchema           = openapi.SchemaOf(model.OIDCLoginRequest{})
+
+	linkSchema              = openapi.SchemaOf(model.LinkRequest{})
+	linkResetPasswordSchema = openapi.SchemaOf(model.LinkResetPasswordRequest{})
+)
+
+// Path and query parameters of the /api/v1 routes. The handlers read them from the URL
+// themselves; these structs describe what they accept with the same validate tags as the
+// request bodies. Path parameters that aren't listed are plain strings.
+type (
+	userSearchParams struct {
+		Query string `json:"query" validate:"required" doc:"Part of a username"`
+	}
+	accountExportParams struct {
+		Format string `json:"format" validate:"omitempty,oneof=json zip" doc:"Defaults to json"`
+	}
+	eventImportParams struct {
+		URL string `json:"url" validate:"omitempty,url" doc:"Timetable to fetch when no icsFile is uploaded"`
+	}
+	countryParams struct {
+		Search string `json:"search" doc:"Start of a country name; shorter than 3 characters returns no countries"`
+	}
+	cityParams struct {
+		Country string `json:"country" validate:"required"`
+	}
+	newsParams struct {
+		Mode    string `json:"mode" validate:"omitempty,oneof=local global" doc:"local picks the country parameter or the user's profile country"`
+		Country string `json:"country"`
+		Q       string `json:"q"`
+		Limit   int    `json:"limit" validate:"omitempty,min=1" doc:"Number of articles, default 30"`
+	}
+
+	journalFilterParams struct {
+		Tag     string `json:"tag"`
+		Mood    int    `json:"mood" validate:"omitempty,min=1,max=5"`
+		MinMood int    `json:"minMood" validate:"omitempty,min=1,max=5"`
+		MaxMood int    `json:"maxMood" validate:"omitempty,min=1,max=5"`
+	}
+	journalSearchParams struct {
+		Q    string `json:"q" validate:"required" doc:"Words to look for in the title, tags and text"`
+		From string `json:"from" validate:"omitempty,date"`
+		To   string `json:"to" validate:"omitempty,date"`
+		journalFilterParams
+	}
+	journalCreateParams struct {
+		Section string `json:"section" validate:"omitempty,oneof=new" doc:"new adds a section to a day that already has an entry"`
+	}
+	journalStatsParams struct {
+		TZ string `json:"tz" validate:"omitempty,timezone" doc:"Time zone the days are counted in, default UTC"`
+	}
+	journalExportParams struct {
+		Format string `json:"format" validate:"omitempty,oneof=md pdf json" doc:"Defaults to md"`
+	}
+	journalImportParams struct {
+		DryRun bool `json:"dryRun" doc:"Report what would be imported without saving it"`
+	}
+	journalPromptParams struct {
+		Lang string `json:"lang" doc:"Language code, e.g. en or nb; defaults to Accept-Language"`
+		Date string `json:"date" validate:"omitempty,date" doc:"Defaults to today in the time zone of the user's reminder"`
+	}
+	journalParams struct {
+		Owner string `json:"owner" doc:"User ID of the entry's owner; defaults to the logged-in user"`
+	}
+	revisionDiffParams struct {
+		From string `json:"from" validate:"required" doc:"Revision ID"`
+		To   string `json:"to" doc:"Revision ID, or current (the default)"`
+	}
+	journalDayParams struct {
+		Date string `json:"date" validate:"required,date"`
+	}
+	journalDaySectionParams struct {
+		Date    string `json:"date" validate:"required,date"`
+		Section int    `json:"section" validate:"omitempty,min=0" doc:"Extra section to write instead of the main entry"`
+	}
+)
+
+var (
+	userSearchParamsSchema    = openapi.SchemaOf(userSearchParams{})
+	accountExportParamsSchema = openapi.SchemaOf(accountExportParams{})
+	eventImportParamsSchema   = openapi.SchemaOf(eventImportParams{})
+	countryParamsSchema       = openapi.SchemaOf(countryParams{})
+	cityParamsSchema          = openapi.SchemaOf(cityParams{})
+	newsParamsSchema          = openapi.SchemaOf(newsParams{})
+
+	journalFilterParamsSchema     = openapi.SchemaOf(journalFilterParams{})
+	journalSearchParamsSchema     = openapi.SchemaOf(journalSearchParams{})
+	journalCreateParamsSchema     = openapi.SchemaOf(journalCreateParams{})
+	journalStatsParamsSchema      = openapi.SchemaOf(journalStatsParams{})
+	journalExportParamsSchema     = openapi.SchemaOf(journalExportParams{})
+	journalImportParamsSchema     = openapi.SchemaOf(journalImportParams{})
+	journalPromptParamsSchema     = openapi.SchemaOf(journalPromptParams{})
+	journalParamsSchema           = openapi.SchemaOf(journalParams{})
+	revisionDiffParamsSchema      = openapi.SchemaOf(revisionDiffParams{})
+	journalDayParamsSchema        = openapi.SchemaOf(journalDayParams{})
+	journalDaySectionParamsSchema = openapi.SchemaOf(journalDaySectionParams{})
+)
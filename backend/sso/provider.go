@@ -0,0 +1,128 @@
+// Package sso logs users in with OpenID Connect providers such as Feide or Google.
+//
+// The app starts a login with Begin and sends the browser to the returned URL. The
+// provider sends it back to OIDC_REDIRECT_URL, a page of the app, with a state and a
+// code in the query, and the app passes both to Finish. Finish signs in the account the
+// provider's ID token names: an account already linked to it, else the account with the
+// same email address, else a new account. Addresses come from the provider, so they
+// count as verified and no code is emailed.
+package sso
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// How long a call to a provider may take
+const providerTimeout = 10 * time.Second
+
+// provider is one configured OpenID Connect provider. Its endpoints are discovered from
+// the issuer on first use.
+type provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// TrustEmail accepts email addresses the provider doesn't mark as verified. Set it
+	// only for providers that assert addresses themselves, like Feide does for
+	// institution accounts.
+	TrustEmail bool
+
+	mutex    sync.Mutex
+	oidc     *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+var (
+	loadOnce    sync.Once
+	providers   map[string]*provider
+	redirectURL string
+)
+
+// loadProviders reads the providers named in OIDC_PROVIDERS, a comma-separated list such
+// as "feide,google". Each needs OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and
+// OIDC_<NAME>_CLIENT_SECRET, and may set OIDC_<NAME>_SCOPES and OIDC_<NAME>_TRUST_EMAIL.
+func loadProviders() {
+	providers = make(map[string]*provider)
+	redirectURL = os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = "http://localhost:3000/login/oidc"
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := &provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			TrustEmail:   os.Getenv(prefix+"TRUST_EMAIL") == "true",
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("OIDC provider %s needs %sISSUER and %sCLIENT_ID; skipping it", name, prefix, prefix)
+			continue
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+		}
+		providers[name] = p
+	}
+}
+
+// lookup returns the configured provider with the given name, or nil
+func lookup(name string) *provider {
+	loadOnce.Do(loadProviders)
+	return providers[strings.ToLower(name)]
+}
+
+// Providers returns the names of the configured providers, for the login page's buttons
+func Providers() []string {
+	loadOnce.Do(loadProviders)
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// discover fetches the provider's endpoints and keys the first time they are needed.
+// A failed discovery is retried on the next login rather than remembered.
+func (p *provider) discover(ctx context.Context) (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.oidc == nil {
+		discovered, err := oidc.NewProvider(ctx, p.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovering %s: %v", p.Issuer, err)
+		}
+		p.oidc = discovered
+		p.verifier = discovered.Verifier(&oidc.Config{ClientID: p.ClientID})
+	}
+	return p.oidc, p.verifier, nil
+}
+
+// config returns the OAuth 2.0 settings for the provider's authorization code flow
+func (p *provider) config(discovered *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     discovered.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       p.Scopes,
+	}
+}
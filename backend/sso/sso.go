@@ -0,0 +1,394 @@
+package sso
+
+import (
+	"backend/audit"
+	"backend/db"
+	"backend/identity"
+	"backend/model"
+	"backend/otp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloud.google.com/go/firestore"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// How long the user has to log in at the provider
+const stateTimeout = 10 * time.Minute
+
+var (
+	// ErrUnknownProvider is returned for a provider name that isn't configured
+	ErrUnknownProvider = errors.New("unknown OIDC provider")
+
+	// ErrStateInvalid is returned when a login's state is unknown, used or expired
+	ErrStateInvalid = errors.New("OIDC login state is invalid or expired")
+
+	// ErrEmailNotVerified is returned when the provider gives no verified email address
+	ErrEmailNotVerified = errors.New("the provider did not give a verified email address")
+)
+
+// loginState is the document stored at oidcStates/{state} while the user is at the provider
+type loginState struct {
+	Provider string
+	Nonce    string
+	Verifier string // PKCE code verifier
+	Expires  time.Time
+}
+
+// claims are the parts of the ID token, or of the user info, that are used
+type claims struct {
+	Subject           string      `json:"sub"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // Some providers send "true" as a string
+	PreferredUsername string      `json:"preferred_username"`
+	GivenName         string      `json:"given_name"`
+	FamilyName        string      `json:"family_name"`
+	Picture           string      `json:"picture"`
+}
+
+// Begin starts a login with the named provider and returns the URL to send the browser
+// to, and the state the app should keep to check the redirect back against
+func Begin(providerName string) (string, string, error) {
+	p := lookup(providerName)
+	if p == nil {
+		return "", "", ErrUnknownProvider
+	}
+	ctx, cancel := context.WithTimeout(db.Ctx, providerTimeout)
+	defer cancel()
+	discovered, _, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	_, err = db.Client.Collection("oidcStates").Doc(state).Set(db.Ctx, loginState{
+		Provider: p.Name,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Expires:  time.Now().Add(stateTimeout),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL := p.config(discovered).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, state, nil
+}
+
+// Finish completes a login started with Begin: it exchanges the code for the provider's
+// ID token, checks it, and returns the ID of the user it signs in, linking or creating
+// the account as needed. created tells whether a new account was made.
+func Finish(r *http.Request, state, code string) (userID string, created bool, err error) {
+	stored, err := takeState(state)
+	if err != nil {
+		return "", false, err
+	}
+	p := lookup(stored.Provider)
+	if p == nil {
+		return "", false, ErrUnknownProvider
+	}
+
+	ctx, cancel := context.WithTimeout(db.Ctx, providerTimeout)
+	defer cancel()
+	discovered, verifier, err := p.discover(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	token, err := p.config(discovered).Exchange(ctx, code, oauth2.VerifierOption(stored.Verifier))
+	if err != nil {
+		return "", false, fmt.Errorf("exchanging code: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", false, errors.New("no id_token in token response")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", false, fmt.Errorf("verifying ID token: %v", err)
+	}
+	if idToken.Nonce != stored.Nonce {
+		return "", false, errors.New("ID token nonce does not match")
+	}
+
+	var info claims
+	if err := idToken.Claims(&info); err != nil {
+		return "", false, err
+	}
+	// Some providers, Feide among them, only give the address from the user info endpoint
+	if info.Email == "" {
+		userInfo, err := discovered.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return "", false, fmt.Errorf("fetching user info: %v", err)
+		}
+		var extra claims
+		if err := userInfo.Claims(&extra); err != nil {
+			return "", false, err
+		}
+		if extra.Subject != info.Subject {
+			return "", false, errors.New("user info is for another subject")
+		}
+		info = mergeClaims(info, extra)
+	}
+	if info.Email == "" || !(isTrue(info.EmailVerified) || (info.EmailVerified == nil && p.TrustEmail)) {
+		return "", false, ErrEmailNotVerified
+	}
+
+	return signIn(r, p, idToken.Issuer, info)
+}
+
+// signIn returns the user linked to the provider account, linking or creating one
+func signIn(r *http.Request, p *provider, issuer string, info claims) (string, bool, error) {
+	identityRef := db.Client.Collection("oidcIdentities").Doc(identityID(issuer, info.Subject))
+	doc, err := identityRef.Get(db.Ctx)
+	switch {
+	case err == nil:
+		var linked model.OIDCIdentity
+		if err := doc.DataTo(&linked); err != nil {
+			return "", false, err
+		}
+		if _, err := identity.UserRef(linked.UserID).Get(db.Ctx); err == nil {
+			return linked.UserID, false, nil
+		} else if status.Code(err) != codes.NotFound {
+			return "", false, err
+		}
+		// The account was deleted; link the provider account afresh below
+		if _, err := identityRef.Delete(db.Ctx); err != nil {
+			return "", false, err
+		}
+	case status.Code(err) != codes.NotFound:
+		return "", false, err
+	}
+
+	link := model.OIDCIdentity{Provider: p.Name, Issuer: issuer, Subject: info.Subject, LinkedAt: time.Now()}
+
+	existingID, err := identity.UserIDByEmail(info.Email)
+	if err == nil {
+		link.UserID = existingID
+		if err := linkExisting(r, identityRef, link); err != nil {
+			return "", false, err
+		}
+		return existingID, false, nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return "", false, err
+	}
+
+	link.UserID = identity.NewUserID()
+	if err := createUser(identityRef, link, info); err != nil {
+		return "", false, err
+	}
+	return link.UserID, true, nil
+}
+
+// linkExisting links the provider account to the user who has its email address. The
+// provider vouches for the address, so an account still waiting for its verification
+// code is verified now. Its password is removed: whoever signed up without verifying
+// may not own the address, and must not keep a way into the account.
+func linkExisting(r *http.Request, identityRef *firestore.DocumentRef, link model.OIDCIdentity) error {
+	userRef := identity.UserRef(link.UserID)
+	return db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		if verified, _ := doc.Data()["IsVerified"].(bool); !verified {
+			if err := tx.Update(userRef, []firestore.Update{
+				{Path: "IsVerified", Value: true},
+				{Path: "Password", Value: ""},
+				{Path: otp.Field(otp.Signup), Value: firestore.Delete},
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(identityRef, link); err != nil {
+			return err
+		}
+		return audit.Add(tx, r, link.UserID, audit.OIDCLink)
+	})
+}
+
+// createUser makes a verified account without a password for the provider account. The
+// user can set a password later with the forgot-password flow.
+func createUser(identityRef *firestore.DocumentRef, link model.OIDCIdentity, info claims) error {
+	username, err := uniqueUsername(info)
+	if err != nil {
+		return err
+	}
+	user := model.User{
+		UserID:        link.UserID,
+		Username:      username,
+		UsernameLower: strings.ToLower(username),
+		Email:         info.Email,
+		FirstName:     info.GivenName,
+		LastName:      info.FamilyName,
+		ImageURL:      info.Picture,
+		IsVerified:    true,
+	}
+	return db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := identity.Reserve(tx, user.Email, user.UserID); err != nil {
+			return err
+		}
+		if err := tx.Create(identity.UserRef(user.UserID), user); err != nil {
+			return err
+		}
+		return tx.Create(identityRef, link)
+	})
+}
+
+// uniqueUsername picks a username from the provider's claims, adding a number if another
+// user already has it
+func uniqueUsername(info claims) (string, error) {
+	base := info.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(info.Email, "@")
+	}
+	base = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, base)
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 2; i < 100; i++ {
+		docs, err := db.Client.Collection("users").Where("UsernameLower", "==", strings.ToLower(candidate)).Limit(1).Documents(db.Ctx).GetAll()
+		if err != nil {
+			return "", err
+		}
+		if len(docs) == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return candidate, nil
+}
+
+// takeState reads and deletes a login's state, so each redirect back is accepted once
+func takeState(state string) (*loginState, error) {
+	ref := db.Client.Collection("oidcStates").Doc(state)
+	var stored loginState
+	err := db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrStateInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&stored); err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(stored.Expires) {
+		return nil, ErrStateInvalid
+	}
+	return &stored, nil
+}
+
+// DeleteExpiredStates removes the states of logins that were never finished
+func DeleteExpiredStates() {
+	iter := db.Client.Collection("oidcStates").Where("Expires", "<=", time.Now()).Documents(db.Ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Printf("Error listing expired OIDC states: %v", err)
+			return
+		}
+		if _, err := doc.Ref.Delete(db.Ctx); err != nil {
+			log.Printf("Failed to delete OIDC state %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
+
+// UnlinkUser removes the provider accounts linked to a user, for account deletion
+func UnlinkUser(userID string) error {
+	docs, err := db.Client.Collection("oidcIdentities").Where("UserID", "==", userID).Documents(db.Ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if _, err := doc.Ref.Delete(db.Ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// identityID derives the document ID of a provider account. Issuers are URLs, which
+// can't be used in document IDs as they are.
+func identityID(issuer, subject string) string {
+	sum := sha256.Sum256([]byte(issuer + "\x00" + subject))
+	return hex.EncodeToString(sum[:])
+}
+
+// mergeClaims fills the claims missing from the ID token with those from the user info
+func mergeClaims(token, userInfo claims) claims {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&token.Email, userInfo.Email)
+	fill(&token.PreferredUsername, userInfo.PreferredUsername)
+	fill(&token.GivenName, userInfo.GivenName)
+	fill(&token.FamilyName, userInfo.FamilyName)
+	fill(&token.Picture, userInfo.Picture)
+	if token.EmailVerified == nil {
+		token.EmailVerified = userInfo.EmailVerified
+	}
+	return token
+}
+
+func isTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func randomString() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed of RFC 6238 appendix B, "12345678901234567890", base32-encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, last six of the eight digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := func(offset time.Duration) string {
+		c, err := Code(rfcSecret, Step(now.Add(offset)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+		step   int64
+	}{
+		{name: "current period", secret: rfcSecret, code: code(0), ok: true, step: Step(now)},
+		{name: "previous period", secret: rfcSecret, code: code(-period * time.Second), ok: true, step: Step(now) - 1},
+		{name: "next period", secret: rfcSecret, code: code(period * time.Second), ok: true, step: Step(now) + 1},
+		{name: "two periods ago", secret: rfcSecret, code: code(-2 * period * time.Second), ok: false},
+		{name: "spaces are ignored", secret: rfcSecret, code: code(0)[:3] + " " + code(0)[3:], ok: true, step: Step(now)},
+		{name: "lowercase secret", secret: strings.ToLower(rfcSecret), code: code(0), ok: true, step: Step(now)},
+		{name: "wrong code", secret: rfcSecret, code: "000000", ok: false},
+		{name: "too short", secret: rfcSecret, code: code(0)[:5], ok: false},
+		{name: "too long", secret: rfcSecret, code: code(0) + "1", ok: false},
+		{name: "bad secret", secret: "not base32!", code: code(0), ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now)
+			if ok != tt.ok || (ok && step != tt.step) {
+				t.Errorf("Validate() = %d, %v; want %d, %v", step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if a == b || len(a) != 32 {
+		t.Errorf("NewSecret() = %q, %q; want two different 32-character secrets", a, b)
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("Code() rejects a new secret: %v", err)
+	}
+}
@@ -1,36 +1,26 @@
 package user
 
 import (
-	"backend/db"
+	"backend/apierror"
 	"backend/email"
-	"backend/function"
-	"cloud.google.com/go/firestore"
+	"backend/identity"
+	"backend/magiclink"
+	"backend/model"
+	"backend/otp"
+	"backend/validation"
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"time"
 )
 
 func ForgotPassword(w http.ResponseWriter, r *http.Request) {
-	var requestData struct {
-		Email string `json:"email"`
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Unable to read request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(body, &requestData)
-	if err != nil {
-		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+	var requestData model.EmailRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
 		return
 	}
 
-	doc, err := db.Client.Collection("users").Doc(requestData.Email).Get(db.Ctx)
+	doc, err := identity.UserByEmail(requestData.Email)
 	if err != nil || !doc.Exists() {
 		// Do not reveal if the email exists
 		w.Header().Set("Content-Type", "application/json")
@@ -45,31 +35,32 @@ func ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	// Check if user is verified
 	isVerified, ok := userData["IsVerified"].(bool)
 	if !ok || !isVerified {
-		http.Error(w, "Email not verified", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.EmailNotVerified, "Email not verified")
 		return
 	}
 
 	// Generate OTP
-	otpCode := function.GenerateOTP()
-	otpExpiresAt := time.Now().Add(5 * time.Minute)
+	otpCode, err := otp.Issue(doc.Ref, otp.PasswordReset, 5*time.Minute)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate OTP")
+		return
+	}
 
-	// Update user document
-	_, err = db.Client.Collection("users").Doc(requestData.Email).Update(db.Ctx, []firestore.Update{
-		{Path: "OTP", Value: otpCode},
-		{Path: "OTPExpiresAt", Value: otpExpiresAt},
-	})
+	link, err := magiclink.Issue(doc.Ref, magiclink.PasswordReset, 5*time.Minute)
 	if err != nil {
-		http.Error(w, "Failed to generate OTP", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate OTP")
 		return
 	}
 
 	// Send OTP email
-	subject := "Your Password Reset Code"
-	bodyText := fmt.Sprintf("Your OTP for password reset is: %s. It will expire in 5 minutes.", otpCode)
-	err = email.SendOTPEmail(requestData.Email, subject, bodyText)
+	err = email.Send(requestData.Email, email.UserLanguage(doc), "password_reset", map[string]interface{}{
+		"Code":    otpCode,
+		"Link":    link,
+		"Minutes": 5,
+	})
 	if err != nil {
 		log.Printf("Failed to send OTP email: %v", err)
-		function.WriteJSONError(w, "Failed to send OTP email", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send OTP email")
 		return
 	}
 
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/model"
 	"encoding/json"
@@ -15,7 +16,7 @@ var jwtSecretKey = os.Getenv("JWT_SECRET_KEY")
 func GetUserInfo(w http.ResponseWriter, r *http.Request) {
 	tokenString := r.Header.Get("Authorization")
 	if tokenString == "" {
-		http.Error(w, "Authorization token is missing", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.TokenMissing, "Authorization token is missing")
 		return
 	}
 
@@ -26,23 +27,25 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request) {
 		return []byte(jwtSecretKey), nil
 	})
 
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+	if err != nil || !token.Valid || claims.UserID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.TokenInvalid, "Invalid or expired token")
 		return
 	}
 
-	doc, err := db.Client.Collection("users").Doc(claims.Email).Get(db.Ctx)
+	doc, err := db.Client.Collection("users").Doc(claims.UserID).Get(db.Ctx)
 	if err != nil || !doc.Exists() {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.UserNotFound, "User not found")
 		return
 	}
 
 	userData := doc.Data()
 
 	w.Header().Set("Content-Type", "application/json")
+	email, _ := userData["Email"].(string)
 	json.NewEncoder(w).Encode(map[string]string{
+		"userID":   claims.UserID,
 		"username": userData["Username"].(string),
-		"email":    claims.Email,
+		"email":    email,
 		"imageUrl": userData["ImageURL"].(string),
 	})
 }
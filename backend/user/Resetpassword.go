@@ -1,93 +1,59 @@
 package user
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/function"
+	"backend/identity"
+	"backend/magiclink"
+	"backend/model"
+	"backend/otp"
+	"backend/validation"
 	"cloud.google.com/go/firestore"
 	"encoding/json"
-	"io"
 	"net/http"
-	"time"
 )
 
 func ResetPassword(w http.ResponseWriter, r *http.Request) {
-	var requestData struct {
-		Email       string `json:"email"`
-		OTP         string `json:"otp"`
-		NewPassword string `json:"newPassword"`
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Unable to read request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(body, &requestData)
-	if err != nil {
-		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+	var requestData model.ResetPasswordRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
 		return
 	}
 
 	// Validate new password
 	if !function.IsValidPassword(requestData.NewPassword) {
-		http.Error(w, "Password must be at least 8 characters long, contain at least one uppercase letter, one digit, and one special character", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.WeakPassword, "Password must be at least 8 characters long, contain at least one uppercase letter, one digit, and one special character")
 		return
 	}
 
-	doc, err := db.Client.Collection("users").Doc(requestData.Email).Get(db.Ctx)
+	doc, err := identity.UserByEmail(requestData.Email)
 	if err != nil || !doc.Exists() {
-		http.Error(w, "Invalid email or OTP", http.StatusBadRequest)
-		return
-	}
-
-	userData := doc.Data()
-
-	// Check OTP and expiry
-	storedOTP, ok := userData["OTP"].(string)
-	if !ok || storedOTP != requestData.OTP {
-		http.Error(w, "Invalid OTP", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidOTP, "Invalid email or OTP")
 		return
 	}
 
-	otpExpiresAtInterface, ok := userData["OTPExpiresAt"]
-	if !ok {
-		http.Error(w, "OTP expiry not found", http.StatusBadRequest)
+	// Check the OTP; a right one is used up
+	if !otp.Check(w, doc.Ref, otp.PasswordReset, requestData.OTP) {
 		return
 	}
 
-	var otpExpiresAt time.Time
-	switch v := otpExpiresAtInterface.(type) {
-	case time.Time:
-		otpExpiresAt = v
-	case *time.Time:
-		otpExpiresAt = *v
-	default:
-		// Handle Firestore timestamp
-		if t, ok := otpExpiresAtInterface.(interface{ Time() time.Time }); ok {
-			otpExpiresAt = t.Time()
-		} else {
-			http.Error(w, "Invalid OTP expiry format", http.StatusBadRequest)
-			return
-		}
-	}
-
-	if time.Now().After(otpExpiresAt) {
-		http.Error(w, "OTP has expired", http.StatusBadRequest)
-		return
-	}
+	setPassword(w, doc.Ref, requestData.NewPassword)
+}
 
+// setPassword stores the new password, retires the reset code and link, and answers the
+// request
+func setPassword(w http.ResponseWriter, userRef *firestore.DocumentRef, newPassword string) {
 	// Hash new password
-	hashedPassword := function.HashPassword(requestData.NewPassword)
+	hashedPassword := function.HashPassword(newPassword)
 
-	// Update user's password and remove OTP fields
-	_, err = db.Client.Collection("users").Doc(requestData.Email).Update(db.Ctx, []firestore.Update{
+	// Update user's password
+	_, err := userRef.Update(db.Ctx, []firestore.Update{
 		{Path: "Password", Value: hashedPassword},
-		{Path: "OTP", Value: firestore.Delete},
-		{Path: "OTPExpiresAt", Value: firestore.Delete},
+		{Path: otp.Field(otp.PasswordReset), Value: firestore.Delete},
+		{Path: magiclink.Field(magiclink.PasswordReset), Value: firestore.Delete},
 	})
 	if err != nil {
-		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to reset password")
 		return
 	}
 
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"encoding/json"
 	"log"
@@ -12,15 +13,15 @@ import (
 func SearchUsersByUsername(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("query")
 	if query == "" {
-		http.Error(w, "Missing search query", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.MissingParameter, "Missing search query")
 		return
 	}
 
 	// Convert the query to lowercase for case-insensitive search
 	queryLower := strings.ToLower(query)
 
-	// Retrieve the current user's email from JWT token context
-	currentUserEmail := r.Context().Value("userEmail").(string)
+	// Retrieve the current user's ID from JWT token context
+	currentUserID := r.Context().Value("userID").(string)
 
 	// Log the search query for debugging
 	log.Printf("Search query: %s", queryLower)
@@ -35,7 +36,7 @@ func SearchUsersByUsername(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Search results count: %d", len(docs))
 
 	if err != nil || len(docs) == 0 {
-		http.Error(w, "No users found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "No users found")
 		return
 	}
 
@@ -47,22 +48,20 @@ func SearchUsersByUsername(w http.ResponseWriter, r *http.Request) {
 		if !ok {
 			continue // Skip if Username field doesn't exist
 		}
-		email, ok := data["Email"].(string)
-		if !ok {
-			continue // Skip if Email field doesn't exist
-		}
+		email, _ := data["Email"].(string)
+		userID := doc.Ref.ID
 
 		// Determine the friend request status
 		status := "none" // default status if no relationship is found
 
 		// Check if the current user has already sent a friend request
-		docRef := db.Client.Collection("friends").Doc(currentUserEmail + "_" + email)
+		docRef := db.Client.Collection("friends").Doc(currentUserID + "_" + userID)
 		docSnapshot, _ := docRef.Get(db.Ctx)
 		if docSnapshot.Exists() {
 			status = docSnapshot.Data()["Status"].(string)
 		} else {
 			// Check if the searched user has already sent a friend request to the current user
-			recipientToSenderDocRef := db.Client.Collection("friends").Doc(email + "_" + currentUserEmail)
+			recipientToSenderDocRef := db.Client.Collection("friends").Doc(userID + "_" + currentUserID)
 			recipientToSenderDocSnapshot, _ := recipientToSenderDocRef.Get(db.Ctx)
 			if recipientToSenderDocSnapshot.Exists() {
 				status = recipientToSenderDocSnapshot.Data()["Status"].(string)
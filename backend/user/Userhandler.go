@@ -1,8 +1,8 @@
 package user
 
 import (
+	"backend/apierror"
 	"backend/db"
-	"backend/function"
 	"cloud.google.com/go/firestore"
 	"net/http"
 	"strconv"
@@ -24,37 +24,37 @@ func handleNonExistentUserLogin(w http.ResponseWriter) {
 }
 
 // Function to handle failed login attempts
-func handleFailedLoginAttempt(w http.ResponseWriter, email string, failedAttempts int64, messagePrefix string) {
+func handleFailedLoginAttempt(w http.ResponseWriter, userID string, failedAttempts int64, messagePrefix string) {
 	// Increment failed attempts
 	failedAttempts++
 
 	var warningMessage string
 	if failedAttempts >= maxFailedAttempts {
-		if email != "" {
-			// Lock the account for a certain duration if email exists
+		if userID != "" {
+			// Lock the account for a certain duration if the user exists
 			lockUntilTime := time.Now().Add(time.Duration(lockDurationMinutes) * time.Minute)
 
-			_, err := db.Client.Collection("users").Doc(email).Update(db.Ctx, []firestore.Update{
+			_, err := db.Client.Collection("users").Doc(userID).Update(db.Ctx, []firestore.Update{
 				{Path: "FailedLoginAttempts", Value: 0},
 				{Path: "AccountLockedUntil", Value: lockUntilTime},
 			})
 			if err != nil {
-				function.WriteJSONError(w, "Error updating lock status", http.StatusInternalServerError)
+				apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error updating lock status")
 				return
 			}
 		}
 
 		// Show lock message
-		function.WriteJSONError(w, "Too many failed login attempts. Account is locked for 30 minutes.", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.AccountLocked, "Too many failed login attempts. Account is locked for 30 minutes.")
 		return
 	} else {
-		// Update failed attempts in the database if email exists
-		if email != "" {
-			_, err := db.Client.Collection("users").Doc(email).Update(db.Ctx, []firestore.Update{
+		// Update failed attempts in the database if the user exists
+		if userID != "" {
+			_, err := db.Client.Collection("users").Doc(userID).Update(db.Ctx, []firestore.Update{
 				{Path: "FailedLoginAttempts", Value: failedAttempts},
 			})
 			if err != nil {
-				function.WriteJSONError(w, "Error updating login attempts", http.StatusInternalServerError)
+				apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error updating login attempts")
 				return
 			}
 		}
@@ -67,7 +67,7 @@ func handleFailedLoginAttempt(w http.ResponseWriter, email string, failedAttempt
 			warningMessage = messagePrefix + "This is your last attempt."
 		}
 
-		function.WriteJSONError(w, warningMessage, http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.InvalidCredentials, warningMessage)
 		return
 	}
 }
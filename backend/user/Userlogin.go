@@ -1,11 +1,13 @@
 package user
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/function"
+	"backend/identity"
 	"backend/model"
+	"backend/validation"
 	"encoding/json"
-	"io"
 	"log"
 	"net/http"
 	"time"
@@ -15,21 +17,13 @@ import (
 
 // User Login Handler with failed attempts tracking and account lock logic
 func UserLogin(w http.ResponseWriter, r *http.Request) {
-	var loginData model.User
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		function.WriteJSONError(w, "Unable to read request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(body, &loginData)
-	if err != nil {
-		function.WriteJSONError(w, "Invalid JSON data", http.StatusBadRequest)
+	var loginData model.LoginRequest
+	if !validation.DecodeJSON(w, r, &loginData) {
 		return
 	}
 
 	// Get user document from Firestore
-	doc, err := db.Client.Collection("users").Doc(loginData.Email).Get(db.Ctx)
+	doc, err := identity.UserByEmail(loginData.Email)
 
 	// Check if email exists
 	if err != nil || !doc.Exists() {
@@ -41,29 +35,20 @@ func UserLogin(w http.ResponseWriter, r *http.Request) {
 	userData := doc.Data()
 
 	// Check if the account is locked
-	if lockedUntilInterface, ok := userData["AccountLockedUntil"]; ok && lockedUntilInterface != nil {
-		lockedUntil, ok := lockedUntilInterface.(time.Time)
-		if !ok {
-			log.Printf("Unexpected type for AccountLockedUntil: %T, value: %v", lockedUntilInterface, lockedUntilInterface)
-			function.WriteJSONError(w, "Invalid lock time format", http.StatusInternalServerError)
-			return
-		}
-		if time.Now().Before(lockedUntil) {
-			function.WriteJSONError(w, "Account is temporarily locked. Please try again later.", http.StatusUnauthorized)
-			return
-		}
+	if isAccountLocked(w, userData) {
+		return
 	}
 
 	// Check if user is verified
 	isVerified, ok := userData["IsVerified"].(bool)
 	if !ok || !isVerified {
-		function.WriteJSONError(w, "Email not verified. Please verify your email before logging in.", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.EmailNotVerified, "Email not verified. Please verify your email before logging in.")
 		return
 	}
 
 	storedPassword, ok := userData["Password"].(string)
 	if !ok {
-		function.WriteJSONError(w, "Invalid user data", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Invalid user data")
 		return
 	}
 
@@ -75,25 +60,48 @@ func UserLogin(w http.ResponseWriter, r *http.Request) {
 			// If 'FailedLoginAttempts' doesn't exist, initialize it to 0
 			failedAttempts = 0
 		}
-		handleFailedLoginAttempt(w, loginData.Email, failedAttempts, "Email or password is incorrect. You have ")
+		handleFailedLoginAttempt(w, doc.Ref.ID, failedAttempts, "Email or password is incorrect. You have ")
+		return
+	}
+
+	finishLogin(w, doc)
+}
+
+// finishLogin answers a login whose first factor checked out: with two-factor
+// authentication it returns the token for UserLoginMFA, otherwise it resets the failed
+// attempts and returns the user's token
+func finishLogin(w http.ResponseWriter, doc *firestore.DocumentSnapshot) {
+	// With two-factor authentication the login continues in UserLoginMFA. Failed attempts
+	// are only reset there, so they also count guesses of the second factor.
+	if mfaEnabled, _ := doc.Data()["TOTPEnabled"].(bool); mfaEnabled {
+		mfaToken, err := function.GenerateMFAPendingJWT(doc.Ref.ID)
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate JWT token")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"mfaRequired": true,
+			"mfaToken":    mfaToken,
+		})
 		return
 	}
 
-	// Password is correct, reset failed attempts after successful login
-	_, err = db.Client.Collection("users").Doc(loginData.Email).Update(db.Ctx, []firestore.Update{
+	// Login is correct, reset failed attempts after successful login
+	_, err := doc.Ref.Update(db.Ctx, []firestore.Update{
 		{Path: "FailedLoginAttempts", Value: 0},
 		{Path: "AccountLockedUntil", Value: firestore.Delete}, // Correctly delete the field
 	})
 
 	if err != nil {
-		function.WriteJSONError(w, "Error resetting login attempts", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error resetting login attempts")
 		return
 	}
 
 	// Generate JWT token
-	token, err := function.GenerateJWT(loginData.Email)
+	token, err := function.GenerateJWT(doc.Ref.ID)
 	if err != nil {
-		function.WriteJSONError(w, "Failed to generate JWT token", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate JWT token")
 		return
 	}
 
@@ -102,3 +110,23 @@ func UserLogin(w http.ResponseWriter, r *http.Request) {
 		"token": token,
 	})
 }
+
+// isAccountLocked writes a 401 and returns true while the account is locked after too
+// many failed login attempts
+func isAccountLocked(w http.ResponseWriter, userData map[string]interface{}) bool {
+	lockedUntilInterface, ok := userData["AccountLockedUntil"]
+	if !ok || lockedUntilInterface == nil {
+		return false
+	}
+	lockedUntil, ok := lockedUntilInterface.(time.Time)
+	if !ok {
+		log.Printf("Unexpected type for AccountLockedUntil: %T, value: %v", lockedUntilInterface, lockedUntilInterface)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Invalid lock time format")
+		return true
+	}
+	if time.Now().Before(lockedUntil) {
+		apierror.Write(w, http.StatusUnauthorized, apierror.AccountLocked, "Account is temporarily locked. Please try again later.")
+		return true
+	}
+	return false
+}
@@ -1,15 +1,20 @@
 package user
 
 import (
+	"backend/apierror"
 	"backend/db"
 	"backend/email"
 	"backend/function"
+	"backend/identity"
+	"backend/magiclink"
 	"backend/model"
+	"backend/otp"
+	"backend/validation"
+	"cloud.google.com/go/firestore"
+	"context"
 	"encoding/json"
-	"fmt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -18,45 +23,44 @@ import (
 
 // User Signup Handler
 func UserSignup(w http.ResponseWriter, r *http.Request) {
-	var user model.User
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		function.WriteJSONError(w, "Unable to read request body", http.StatusBadRequest)
+	var request model.SignupRequest
+	if !validation.DecodeJSON(w, r, &request) {
 		return
 	}
 
-	err = json.Unmarshal(body, &user)
-	if err != nil {
-		function.WriteJSONError(w, "Invalid JSON data", http.StatusBadRequest)
-		return
+	// Only the fields of the signup form are taken from the request
+	user := model.User{
+		Username:    request.Username,
+		Email:       request.Email,
+		Password:    request.Password,
+		Country:     request.Country,
+		CountryCode: request.CountryCode,
+		City:        request.City,
+		FirstName:   request.FirstName,
+		LastName:    request.LastName,
+		ImageURL:    request.ImageURL,
+		Language:    request.Language,
 	}
-
-	// Validate that country, city, email, username, and password are provided
-	if user.Country == "" || user.City == "" || user.Email == "" || user.Username == "" || user.Password == "" {
-		function.WriteJSONError(w, "Country, City, Email, Username, and Password are required", http.StatusBadRequest)
-		return
+	if user.Language == "" {
+		user.Language = email.Language(r.Header.Get("Accept-Language"))
 	}
 
 	// Check if the email already exists in the database
-	doc, err := db.Client.Collection("users").Doc(user.Email).Get(db.Ctx)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			// Email not registered, proceed
-		} else {
-			// Log and return if there is any other error
-			log.Printf("Error retrieving document for email %s: %v", user.Email, err)
-			function.WriteJSONError(w, "Failed to check if email exists", http.StatusInternalServerError)
-			return
-		}
-	} else if doc.Exists() {
-		// If document exists, return conflict status
-		function.WriteJSONError(w, "Email already registered", http.StatusConflict)
+	_, err := identity.UserIDByEmail(user.Email)
+	if err == nil {
+		apierror.Write(w, http.StatusConflict, apierror.EmailAlreadyRegistered, "Email already registered")
+		return
+	}
+	if status.Code(err) != codes.NotFound {
+		// Log and return if there is any other error
+		log.Printf("Error looking up email %s: %v", user.Email, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check if email exists")
 		return
 	}
 
 	// Validate password complexity
 	if !function.IsValidPassword(user.Password) {
-		function.WriteJSONError(w, "Password must be at least 8 characters long, contain at least one uppercase letter, one digit, and one special character", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.WeakPassword, "Password must be at least 8 characters long, contain at least one uppercase letter, one digit, and one special character")
 		return
 	}
 
@@ -70,25 +74,47 @@ func UserSignup(w http.ResponseWriter, r *http.Request) {
 	user.UsernameLower = strings.ToLower(user.Username)
 
 	// Generate OTP
-	otpCode := function.GenerateOTP()
-	otpExpireAt := time.Now().Add(5 * time.Minute)
+	otpCode, record, err := otp.New(otp.Signup, 5*time.Minute)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate OTP")
+		return
+	}
+	user.OTPs = map[string]model.OTP{string(otp.Signup): record}
 
-	user.OTP = otpCode
-	user.OTPExpiresAt = otpExpireAt
+	// The email also carries a link that verifies the address without typing the code
+	user.UserID = identity.NewUserID()
+	link, linkID, err := magiclink.New(user.UserID, magiclink.VerifyEmail, 5*time.Minute)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate OTP")
+		return
+	}
+	user.MagicLinks = map[string]string{string(magiclink.VerifyEmail): linkID}
 
-	// Save the user to Firestore
-	_, err = db.Client.Collection("users").Doc(user.Email).Set(db.Ctx, user)
+	// Save the user to Firestore under the new ID, claiming the email in the same transaction
+	err = db.Client.RunTransaction(db.Ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := identity.Reserve(tx, user.Email, user.UserID); err != nil {
+			return err
+		}
+		return tx.Create(identity.UserRef(user.UserID), user)
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		apierror.Write(w, http.StatusConflict, apierror.EmailAlreadyRegistered, "Email already registered")
+		return
+	}
 	if err != nil {
-		function.WriteJSONError(w, "Failed to create user", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to create user")
 		return
 	}
 
 	// Send OTP email
-	subject := "Your Verification Code"
-	bodyText := fmt.Sprintf("Your OTP for email verification is: %s. It will expire in 5 minutes.", otpCode)
-	err = email.SendOTPEmail(user.Email, subject, bodyText)
+	err = email.Send(user.Email, user.Language, "verify_email", map[string]interface{}{
+		"Code":    otpCode,
+		"Link":    link,
+		"Minutes": 5,
+	})
 	if err != nil {
-		function.WriteJSONError(w, "Failed to send OTP email", http.StatusInternalServerError)
+		log.Printf("Failed to send verification email: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send OTP email")
 		return
 	}
 
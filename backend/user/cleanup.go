@@ -3,9 +3,13 @@ package user
 
 import (
 	"backend/db"
+	"backend/identity"
+	"backend/otp"
 	"context"
 	"log"
 	"time"
+
+	"cloud.google.com/go/firestore"
 )
 
 // DeleteExpiredUnverifiedUsers deletes users who have not verified their email within the OTP expiration time.
@@ -13,10 +17,21 @@ func DeleteExpiredUnverifiedUsers() {
 	ctx := context.Background()
 	cutoffTime := time.Now()
 
-	// Query users where IsVerified is false and OTPExpiresAt is before or equal to cutoffTime
+	// Query users where IsVerified is false and their signup code expired before cutoffTime.
+	// Users who signed up before codes were hashed have their expiry in OTPExpiresAt.
+	var deletedCount int
+	for _, expiryField := range []string{otp.Field(otp.Signup) + ".ExpiresAt", "OTPExpiresAt"} {
+		deletedCount += deleteUnverified(ctx, expiryField, cutoffTime)
+	}
+
+	log.Printf("Cleanup complete. Deleted %d unverified users.", deletedCount)
+}
+
+// deleteUnverified deletes the unverified users whose expiryField is at or before cutoffTime
+func deleteUnverified(ctx context.Context, expiryField string, cutoffTime time.Time) int {
 	iter := db.Client.Collection("users").
 		Where("IsVerified", "==", false).
-		Where("OTPExpiresAt", "<=", cutoffTime).
+		Where(expiryField, "<=", cutoffTime).
 		Documents(ctx)
 	defer iter.Stop()
 
@@ -28,11 +43,25 @@ func DeleteExpiredUnverifiedUsers() {
 				break
 			}
 			log.Printf("Error iterating documents: %v", err)
-			return
+			return deletedCount
+		}
+
+		// A user from before hashed codes who has since asked for a new one is left to the
+		// query on the new field
+		if otps, _ := doc.Data()["OTPs"].(map[string]interface{}); expiryField == "OTPExpiresAt" && otps[string(otp.Signup)] != nil {
+			continue
 		}
 
-		// Delete the user document
-		_, err = db.Client.Collection("users").Doc(doc.Ref.ID).Delete(ctx)
+		// Delete the user document and free the email for a new signup
+		email, _ := doc.Data()["Email"].(string)
+		err = db.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			if email != "" {
+				if err := identity.Release(tx, email); err != nil {
+					return err
+				}
+			}
+			return tx.Delete(doc.Ref)
+		})
 		if err != nil {
 			log.Printf("Failed to delete user %s: %v", doc.Ref.ID, err)
 			continue // Continue deleting other users
@@ -41,5 +70,5 @@ func DeleteExpiredUnverifiedUsers() {
 		deletedCount++
 	}
 
-	log.Printf("Cleanup complete. Deleted %d unverified users.", deletedCount)
+	return deletedCount
 }
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/email"
+	"backend/identity"
+	"backend/magiclink"
+	"backend/model"
+	"backend/validation"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// How long a login link works
+const loginLinkLifetime = 15 * time.Minute
+
+// UserLoginLinkRequest emails a link that logs the user in without their password. Like
+// ForgotPassword it answers the same whether or not the address has an account.
+func UserLoginLinkRequest(w http.ResponseWriter, r *http.Request) {
+	var requestData model.EmailRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
+		return
+	}
+
+	respond := func() {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "If the email belongs to a verified account, a login link has been sent.",
+		})
+	}
+
+	// Only verified addresses get a link; anyone else is told the same as everyone
+	doc, err := identity.UserByEmail(requestData.Email)
+	if err != nil || !doc.Exists() {
+		respond()
+		return
+	}
+	if isVerified, _ := doc.Data()["IsVerified"].(bool); !isVerified {
+		respond()
+		return
+	}
+
+	link, err := magiclink.Issue(doc.Ref, magiclink.Login, loginLinkLifetime)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate login link")
+		return
+	}
+
+	err = email.Send(requestData.Email, email.UserLanguage(doc), "login_link", map[string]interface{}{
+		"Link":    link,
+		"Minutes": int(loginLinkLifetime.Minutes()),
+	})
+	if err != nil {
+		log.Printf("Failed to send login link email: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send login link email")
+		return
+	}
+
+	respond()
+}
+
+// UserLoginLink logs in with the token from a login link and answers like UserLogin. The
+// link stands in for the password only, so two-factor authentication still applies.
+func UserLoginLink(w http.ResponseWriter, r *http.Request) {
+	var requestData model.LinkRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
+		return
+	}
+
+	userID, ok := magiclink.Check(w, requestData.Token, magiclink.Login)
+	if !ok {
+		return
+	}
+
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	if isAccountLocked(w, doc.Data()) {
+		return
+	}
+
+	finishLogin(w, doc)
+}
@@ -0,0 +1,78 @@
+package user
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/function"
+	"backend/identity"
+	"backend/mfa"
+	"backend/model"
+	"backend/validation"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+)
+
+// UserLoginMFA is the second step of a login with two-factor authentication. It takes
+// the token UserLogin returned and a code from the authenticator app or a recovery code,
+// and returns the full token. Wrong codes count towards the account lock like wrong
+// passwords do.
+func UserLoginMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		apierror.Write(w, http.StatusUnauthorized, apierror.Unauthorized, "User ID not found in context")
+		return
+	}
+
+	var request model.MFACodeRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	userData := doc.Data()
+	if isAccountLocked(w, userData) {
+		return
+	}
+
+	valid, err := mfa.Verify(r, userID, request.Code)
+	if errors.Is(err, mfa.ErrNotEnabled) {
+		apierror.Write(w, http.StatusBadRequest, apierror.MFANotEnabled, "Two-factor authentication is not enabled")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check two-factor code")
+		return
+	}
+	if !valid {
+		failedAttempts, _ := userData["FailedLoginAttempts"].(int64)
+		handleFailedLoginAttempt(w, userID, failedAttempts, "Invalid two-factor code. You have ")
+		return
+	}
+
+	_, err = doc.Ref.Update(db.Ctx, []firestore.Update{
+		{Path: "FailedLoginAttempts", Value: 0},
+		{Path: "AccountLockedUntil", Value: firestore.Delete},
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error resetting login attempts")
+		return
+	}
+
+	token, err := function.GenerateJWT(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate JWT token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": token,
+	})
+}
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/identity"
+	"backend/model"
+	"backend/sso"
+	"backend/validation"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OIDCProviders lists the OpenID Connect providers users can log in with
+func OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := sso.Providers()
+	sort.Strings(providers)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"providers": providers})
+}
+
+// UserLoginOIDCBegin starts a login with an OpenID Connect provider. It returns the URL
+// to send the browser to and the state the provider will send back; the app should keep
+// the state and only finish a login that comes back with it.
+func UserLoginOIDCBegin(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := sso.Begin(r.PathValue("provider"))
+	if errors.Is(err, sso.ErrUnknownProvider) {
+		apierror.Write(w, http.StatusNotFound, apierror.OIDCProviderUnknown, "Unknown login provider")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to begin OIDC login: %v", err)
+		apierror.Write(w, http.StatusBadGateway, apierror.UpstreamError, "The login provider is not available")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authURL": authURL,
+		"state":   state,
+	})
+}
+
+// UserLoginOIDC finishes a login with an OpenID Connect provider and answers like
+// UserLogin. Users without an account get one, verified and without a password, and
+// accounts with the provider's email address are linked to it.
+func UserLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	var request model.OIDCLoginRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+
+	userID, created, err := sso.Finish(r, request.State, request.Code)
+	switch {
+	case errors.Is(err, sso.ErrStateInvalid):
+		apierror.Write(w, http.StatusBadRequest, apierror.OIDCStateInvalid, "The login expired. Please try again.")
+		return
+	case errors.Is(err, sso.ErrUnknownProvider):
+		apierror.Write(w, http.StatusNotFound, apierror.OIDCProviderUnknown, "Unknown login provider")
+		return
+	case errors.Is(err, sso.ErrEmailNotVerified):
+		apierror.Write(w, http.StatusForbidden, apierror.OIDCEmailNotVerified, "The login provider did not confirm your email address")
+		return
+	case status.Code(err) == codes.AlreadyExists:
+		apierror.Write(w, http.StatusConflict, apierror.Conflict, "The account is being set up by another login. Please try again.")
+		return
+	case err != nil:
+		log.Printf("OIDC login failed: %v", err)
+		apierror.Write(w, http.StatusUnauthorized, apierror.OIDCLoginFailed, "Login with the provider failed")
+		return
+	}
+	if created {
+		log.Printf("Created user %s from an OIDC login", userID)
+	}
+
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	if isAccountLocked(w, doc.Data()) {
+		return
+	}
+	finishLogin(w, doc)
+}
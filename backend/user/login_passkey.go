@@ -0,0 +1,92 @@
+package user
+
+import (
+	"backend/apierror"
+	"backend/db"
+	"backend/function"
+	"backend/identity"
+	"backend/model"
+	"backend/passkey"
+	"backend/validation"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+)
+
+// UserLoginPasskeyBegin starts a passwordless login and returns the options for the
+// browser's navigator.credentials.get together with a session ID for UserLoginPasskey
+func UserLoginPasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	options, sessionID, err := passkey.BeginLogin()
+	if err != nil {
+		log.Printf("Failed to begin passkey login: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to start passkey login")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessionID": sessionID,
+		"options":   options,
+	})
+}
+
+// UserLoginPasskey finishes a passwordless login and returns the same token as
+// UserLogin. A passkey checks the user's PIN or biometrics on the device, so it stands in
+// for both the password and the two-factor code.
+func UserLoginPasskey(w http.ResponseWriter, r *http.Request) {
+	var request model.PasskeyLoginRequest
+	if !validation.DecodeJSON(w, r, &request) {
+		return
+	}
+
+	userID, err := passkey.FinishLogin(request.SessionID, request.Credential)
+	switch {
+	case errors.Is(err, passkey.ErrSessionInvalid):
+		apierror.Write(w, http.StatusBadRequest, apierror.PasskeySessionInvalid, "Passkey login expired. Please try again.")
+		return
+	case errors.Is(err, passkey.ErrInvalidCredential):
+		log.Printf("Passkey login failed: %v", err)
+		apierror.Write(w, http.StatusUnauthorized, apierror.InvalidPasskey, "The passkey could not be verified")
+		return
+	case err != nil:
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to check passkey")
+		return
+	}
+
+	doc, err := identity.UserRef(userID).Get(db.Ctx)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to retrieve user data")
+		return
+	}
+	userData := doc.Data()
+	if isAccountLocked(w, userData) {
+		return
+	}
+	if isVerified, _ := userData["IsVerified"].(bool); !isVerified {
+		apierror.Write(w, http.StatusUnauthorized, apierror.EmailNotVerified, "Email not verified. Please verify your email before logging in.")
+		return
+	}
+
+	_, err = doc.Ref.Update(db.Ctx, []firestore.Update{
+		{Path: "FailedLoginAttempts", Value: 0},
+		{Path: "AccountLockedUntil", Value: firestore.Delete},
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Error resetting login attempts")
+		return
+	}
+
+	token, err := function.GenerateJWT(userID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to generate JWT token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": token,
+	})
+}
@@ -2,62 +2,53 @@
 package user
 
 import (
-	"backend/db"
+	"backend/apierror"
 	"backend/email"
-	"backend/function"
-	"cloud.google.com/go/firestore"
+	"backend/identity"
+	"backend/magiclink"
+	"backend/model"
+	"backend/otp"
+	"backend/validation"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
 	"time"
 )
 
 // ResendOTP handles requests to resend the OTP for email verification.
 func ResendOTP(w http.ResponseWriter, r *http.Request) {
-	var requestData struct {
-		Email string `json:"email"`
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		function.WriteJSONError(w, "Unable to read request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(body, &requestData)
-	if err != nil {
-		function.WriteJSONError(w, "Invalid JSON data", http.StatusBadRequest)
+	var requestData model.EmailRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
 		return
 	}
 
 	// Get user document from Firestore
-	doc, err := db.Client.Collection("users").Doc(requestData.Email).Get(db.Ctx)
+	doc, err := identity.UserByEmail(requestData.Email)
 	if err != nil || !doc.Exists() {
-		function.WriteJSONError(w, "User not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.UserNotFound, "User not found")
 		return
 	}
 
-	// Generate new OTP
-	newOTP := function.GenerateOTP()
-	newOTPExpireAt := time.Now().Add(5 * time.Minute)
+	// Generate a new OTP, replacing the old one
+	newOTP, err := otp.Issue(doc.Ref, otp.Signup, 5*time.Minute)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update OTP")
+		return
+	}
 
-	// Update user document with new OTP and expiry
-	_, err = db.Client.Collection("users").Doc(requestData.Email).Update(db.Ctx, []firestore.Update{
-		{Path: "OTP", Value: newOTP},
-		{Path: "OTPExpiresAt", Value: newOTPExpireAt},
-	})
+	link, err := magiclink.Issue(doc.Ref, magiclink.VerifyEmail, 5*time.Minute)
 	if err != nil {
-		function.WriteJSONError(w, "Failed to update OTP", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to update OTP")
 		return
 	}
 
 	// Send new OTP email
-	subject := "Your New Verification Code"
-	bodyText := fmt.Sprintf("Your new OTP for email verification is: %s. It will expire in 5 minutes.", newOTP)
-	err = email.SendOTPEmail(requestData.Email, subject, bodyText)
+	err = email.Send(requestData.Email, email.UserLanguage(doc), "verify_email", map[string]interface{}{
+		"Code":    newOTP,
+		"Link":    link,
+		"Minutes": 5,
+	})
 	if err != nil {
-		function.WriteJSONError(w, "Failed to send OTP email", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.InternalError, "Failed to send OTP email")
 		return
 	}
 
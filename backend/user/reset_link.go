@@ -0,0 +1,33 @@
+package user
+
+import (
+	"backend/apierror"
+	"backend/function"
+	"backend/identity"
+	"backend/magiclink"
+	"backend/model"
+	"backend/validation"
+	"net/http"
+)
+
+// ResetPasswordLink sets a new password with the link from the reset email instead of
+// the code
+func ResetPasswordLink(w http.ResponseWriter, r *http.Request) {
+	var requestData model.LinkResetPasswordRequest
+	if !validation.DecodeJSON(w, r, &requestData) {
+		return
+	}
+
+	// Validate new password before the link is used up, so a weak one can be retried
+	if !function.IsValidPassword(requestData.NewPassword) {
+		apierror.Write(w, http.StatusBadRequest, apierror.WeakPassword, "Password must be at least 8 characters long, contain at least one uppercase letter, one digit, and one special character")
+		return
+	}
+
+	userID, ok := magiclink.Check(w, requestData.Token, magiclink.PasswordReset)
+	if !ok {
+		return
+	}
+
+	setPassword(w, identity.UserRef(userID), requestData.NewPassword)
+}
@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"backend/apierror"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxBodySize is the largest JSON request body DecodeJSON accepts
+const MaxBodySize = 1 << 20
+
+// DecodeJSON reads the JSON request body into v and checks v's validate tags. Unknown
+// fields, trailing data, wrong types and bodies over MaxBodySize are rejected. On
+// failure the error response has been written and false is returned.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the JSON body")
+	}
+	if err != nil {
+		writeDecodeError(w, err)
+		return false
+	}
+
+	if errs := Struct(v); len(errs) > 0 {
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.ValidationFailed, "Some fields are invalid", errs)
+		return false
+	}
+	return true
+}
+
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge, "Request body is too large")
+	case errors.Is(err, io.EOF):
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidBody, "Request body is empty")
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "(body)"
+		}
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.ValidationFailed, "Some fields are invalid",
+			[]apierror.FieldError{{Field: field, Message: "must be " + jsonType(typeErr.Type.Kind().String())}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		apierror.WriteDetails(w, http.StatusBadRequest, apierror.ValidationFailed, "Some fields are invalid",
+			[]apierror.FieldError{{Field: field, Message: "is not allowed"}})
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.InvalidBody, "Invalid JSON data")
+	}
+}
+
+// jsonType names a Go kind the way an API client would think of it
+func jsonType(kind string) string {
+	switch {
+	case kind == "string":
+		return "a string"
+	case kind == "bool":
+		return "true or false"
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "a whole number"
+	case strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "slice", kind == "array":
+		return "an array"
+	}
+	return "an object"
+}
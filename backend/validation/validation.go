@@ -0,0 +1,260 @@
+package validation
+
+import (
+	"backend/apierror"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Rule is one entry of a validate struct tag, e.g. "max=200" is {Name: "max", Param: "200"}.
+//
+// Supported rules:
+//
+//	required    the value must not be empty (blank strings count as empty)
+//	omitempty   skip the remaining rules when the value is empty
+//	min=N       minimum length of a string or slice, or minimum value of a number
+//	max=N       maximum length of a string or slice, or maximum value of a number
+//	len=N       exact length of a string
+//	oneof=a b   the string must be one of the space-separated values
+//	email       a plain email address, e.g. ola@example.com
+//	date        a date as YYYY-MM-DD
+//	time        a time of day as HH:MM
+//	timezone    an IANA time zone name, e.g. Europe/Oslo
+//	digits      only the digits 0-9
+//	url         an absolute http or https URL
+//	iso2        an ISO 3166-1 alpha-2 country code, e.g. NO
+//	dive        the rules after it apply to each element of a slice
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// ParseTag splits a validate tag into rules
+func ParseTag(tag string) []Rule {
+	var rules []Rule
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(part, "=")
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+	return rules
+}
+
+// FieldName returns the JSON name of a struct field, or "" if it isn't part of the JSON body
+func FieldName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// Struct checks the validate tags of a struct (or pointer to one) and returns every
+// field that breaks a rule, named by its JSON path
+func Struct(v interface{}) []apierror.FieldError {
+	var errs []apierror.FieldError
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct {
+		validateStruct(value, "", &errs)
+	}
+	return errs
+}
+
+func validateStruct(value reflect.Value, path string, errs *[]apierror.FieldError) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Embedded structs contribute their fields to the same JSON object
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			validateStruct(value.Field(i), path, errs)
+			continue
+		}
+
+		name := FieldName(field)
+		if name == "" {
+			continue
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+		validateValue(value.Field(i), ParseTag(field.Tag.Get("validate")), name, errs)
+	}
+}
+
+func validateValue(value reflect.Value, rules []Rule, path string, errs *[]apierror.FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, apierror.FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// A nil pointer is a field left out of the request; otherwise check the value it points to
+	if value.Kind() == reflect.Pointer && value.Type().Elem().Kind() != reflect.Struct {
+		if value.IsNil() {
+			if len(rules) > 0 && rules[0].Name == "required" {
+				fail("is required")
+			}
+			return
+		}
+		value = value.Elem()
+	}
+
+	for i, rule := range rules {
+		switch rule.Name {
+		case "omitempty":
+			if isEmpty(value) {
+				return
+			}
+
+		case "required":
+			if isEmpty(value) {
+				fail("is required")
+				return
+			}
+
+		case "dive":
+			if value.Kind() == reflect.Slice {
+				for j := 0; j < value.Len(); j++ {
+					validateValue(value.Index(j), rules[i+1:], fmt.Sprintf("%s[%d]", path, j), errs)
+				}
+			}
+			return
+
+		case "min", "max", "len":
+			limit, _ := strconv.Atoi(rule.Param)
+			if message := checkSize(value, rule.Name, limit); message != "" {
+				fail("%s", message)
+			}
+
+		case "oneof":
+			allowed := strings.Fields(rule.Param)
+			if value.Kind() == reflect.String && !contains(allowed, value.String()) {
+				fail("must be one of %s", strings.Join(allowed, ", "))
+			}
+
+		default:
+			if value.Kind() == reflect.String && value.String() != "" {
+				if message := checkFormat(rule.Name, value.String()); message != "" {
+					fail("%s", message)
+				}
+			}
+		}
+	}
+
+	// Nested objects carry their own rules
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() != reflect.TypeOf(time.Time{}) {
+			validateStruct(value, path, errs)
+		}
+	case reflect.Pointer:
+		if !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+			validateStruct(value.Elem(), path, errs)
+		}
+	}
+}
+
+func checkSize(value reflect.Value, rule string, limit int) string {
+	var size int
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = utf8.RuneCountInString(value.String()), " characters"
+	case reflect.Slice, reflect.Map:
+		size, unit = value.Len(), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = int(value.Int())
+	case reflect.Float32, reflect.Float64:
+		size = int(value.Float())
+	default:
+		return ""
+	}
+
+	switch {
+	case rule == "min" && size < limit:
+		return fmt.Sprintf("must be at least %d%s", limit, unit)
+	case rule == "max" && size > limit:
+		return fmt.Sprintf("must be at most %d%s", limit, unit)
+	case rule == "len" && size != limit:
+		return fmt.Sprintf("must be exactly %d%s", limit, unit)
+	}
+	return ""
+}
+
+func checkFormat(rule, value string) string {
+	switch rule {
+	case "email":
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			return "must be a valid email address"
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	case "time":
+		// time.Parse takes a single-digit hour, so check the length for zero padding
+		if _, err := time.Parse("15:04", value); err != nil || len(value) != 5 {
+			return "must be a time of day (HH:MM)"
+		}
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil || value == "Local" {
+			return "must be an IANA time zone, e.g. Europe/Oslo"
+		}
+	case "digits":
+		for _, c := range value {
+			if c < '0' || c > '9' {
+				return "must contain only digits"
+			}
+		}
+	case "url":
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http or https URL"
+		}
+	case "iso2":
+		if !isCountryCode(value) {
+			return "must be an ISO 3166-1 alpha-2 country code"
+		}
+	}
+	return ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package validation
+
+import "testing"
+
+func TestCheckFormat(t *testing.T) {
+	tests := []struct {
+		rule, value string
+		ok          bool
+	}{
+		{"time", "09:05", true},
+		{"time", "23:59", true},
+		{"time", "9:05", false},
+		{"time", "24:00", false},
+		{"time", "09:5", false},
+		{"time", "09:05:00", false},
+		{"date", "2024-01-02", true},
+		{"date", "2024-1-2", false},
+		{"date", "2024-02-30", false},
+		{"digits", "012345", true},
+		{"digits", "12a45", false},
+		{"email", "ola@example.com", true},
+		{"email", "Ola <ola@example.com>", false},
+		{"timezone", "Europe/Oslo", true},
+		{"timezone", "Local", false},
+		{"url", "https://example.com/a.png", true},
+		{"url", "javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+" "+tt.value, func(t *testing.T) {
+			if msg := checkFormat(tt.rule, tt.value); (msg == "") != tt.ok {
+				t.Errorf("checkFormat(%q, %q) = %q, want ok=%v", tt.rule, tt.value, msg, tt.ok)
+			}
+		})
+	}
+}
+
+func TestStructTime(t *testing.T) {
+	type reminder struct {
+		Time string `json:"time" validate:"omitempty,time"`
+	}
+	if errs := Struct(reminder{Time: "9:05"}); len(errs) != 1 || errs[0].Field != "time" {
+		t.Errorf("Struct() = %+v, want one error for time", errs)
+	}
+	if errs := Struct(reminder{}); len(errs) != 0 {
+		t.Errorf("Struct() = %+v, want no errors for an empty optional time", errs)
+	}
+}
@@ -15,6 +15,7 @@ import Minigame from "./components/minigame/Minigame";
 import Calendar from "./components/calendar/Calendar";
 import Journal from './pages/journal/journalPage';
 import PrivateRoute from './components/PrivateRoute';
+import LinkPage from './pages/links/LinkPage';
 
 // Export API Base URL from App.js
 // export const API_BASE_URL = 'http://localhost:8080';
@@ -28,6 +29,9 @@ function App() {
             <Routes>
                 <Route path="/" element={<Home />} />
                 <Route path="/login" element={<LoginSignup />} />
+                <Route path="/links/verify-email" element={<LinkPage purpose="verify-email" />} />
+                <Route path="/links/password-reset" element={<LinkPage purpose="password-reset" />} />
+                <Route path="/links/login" element={<LinkPage purpose="login" />} />
                 <Route path="/edit-profile" element={<EditProfile />} />
 
                 <Route path="/friend" element={<Friend />} />
@@ -89,8 +89,8 @@ const EventModal = ({ onSubmit, onClose, currentDate, user, event = null, isEdit
         })
         .then(response => {
             if (!response.ok) {
-                return response.text().then(text => {
-                    throw new Error(text || 'Failed to import events.');
+                return response.json().catch(() => ({})).then(data => {
+                    throw new Error(data.message || 'Failed to import events.');
                 });
             }
             return response.json();
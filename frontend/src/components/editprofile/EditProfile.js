@@ -5,7 +5,7 @@ import { API_BASE_URL } from '../../App';
 import { useNavigate } from 'react-router-dom';
 
 const EditProfile = () => {
-    const [profileData, setProfileData] = useState({ Username: '', Email: '' });
+    const [profileData, setProfileData] = useState({ username: '', email: '' });
     const [currentPassword, setCurrentPassword] = useState('');
     const [newPassword, setNewPassword] = useState('');
     const [selectedCountry, setSelectedCountry] = useState(null);
@@ -24,8 +24,8 @@ const EditProfile = () => {
                 if (response.ok) {
                     const data = await response.json();
                     setProfileData(data);
-                    if (data.Country) setSelectedCountry({ label: data.Country, value: data.Country });
-                    if (data.City) setSelectedCity({ label: data.City, value: data.City });
+                    if (data.country) setSelectedCountry({ label: data.country, value: data.country });
+                    if (data.city) setSelectedCity({ label: data.city, value: data.city });
                 } else {
                     console.error('Failed to fetch profile data');
                 }
@@ -73,7 +73,7 @@ const EditProfile = () => {
         setMessage('');
         setError('');
 
-        if (!profileData.Username) {
+        if (!profileData.username) {
             setError('Username cannot be empty');
             return;
         }
@@ -84,24 +84,19 @@ const EditProfile = () => {
             return;
         }
 
-        if (!currentPassword) {
-            setError('Please enter your current password to save changes');
+        if (newPassword && !currentPassword) {
+            setError('Please enter your current password to change it');
             return;
         }
 
         const updatedProfile = {
-            ...profileData,
-            Country: selectedCountry ? selectedCountry.value : '',
-            City: selectedCity ? selectedCity.value : '',
-            CurrentPassword: currentPassword,
+            username: profileData.username,
+            country: selectedCountry ? selectedCountry.value : '',
+            city: selectedCity ? selectedCity.value : '',
         };
 
-        if (newPassword) {
-            updatedProfile.NewPassword = newPassword;
-        }
-
         try {
-            const response = await fetch(`${API_BASE_URL}/api/profile`, {
+            let response = await fetch(`${API_BASE_URL}/api/v1/profile`, {
                 method: 'PUT',
                 headers: {
                     'Authorization': `Bearer ${token}`,
@@ -110,14 +105,26 @@ const EditProfile = () => {
                 body: JSON.stringify(updatedProfile),
             });
 
+            // The password has its own endpoint and needs the current password
+            if (response.ok && newPassword) {
+                response = await fetch(`${API_BASE_URL}/api/v1/profile/password`, {
+                    method: 'PUT',
+                    headers: {
+                        'Authorization': `Bearer ${token}`,
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ currentPassword, newPassword }),
+                });
+            }
+
             if (response.ok) {
                 setMessage('Successfully updated your profile');
                 setCurrentPassword('');
                 setNewPassword('');
                 setTimeout(() => navigate('/'), 2000); // Redirect to home after 2 seconds
             } else {
-                const errorText = await response.text();
-                setError(`Error updating profile: ${errorText}`);
+                const errorData = await response.json().catch(() => ({}));
+                setError(`Error updating profile: ${errorData.message || response.statusText}`);
             }
         } catch (error) {
             setError('Error in handleSave');
@@ -133,8 +140,8 @@ const EditProfile = () => {
                 <label>Username</label>
                 <input
                     type="text"
-                    value={profileData.Username}
-                    onChange={(e) => setProfileData({ ...profileData, Username: e.target.value })}
+                    value={profileData.username}
+                    onChange={(e) => setProfileData({ ...profileData, username: e.target.value })}
                     placeholder="Enter your username"
                 />
             </div>
@@ -143,14 +150,14 @@ const EditProfile = () => {
                 <label>Email</label>
                 <input
                     type="email"
-                    value={profileData.Email}
+                    value={profileData.email}
                     placeholder="Enter your email"
                     disabled
                 />
             </div>
 
             <div className="form-group">
-                <label>Current Password</label>
+                <label>Current Password (needed to change password)</label>
                 <input
                     type="password"
                     value={currentPassword}
@@ -174,18 +174,43 @@ const LoginSignup = () => {
                 headers: {
                     'Content-Type': 'application/json',
                 },
-                body: JSON.stringify(formData),
+                body: JSON.stringify({ email: formData.email, password: formData.password }),
             });
 
             if (response.ok) {
                 const data = await response.json();
-                setAuthToken(data.token);
-                localStorage.setItem('auth-token', data.token);
+                let token = data.token;
+
+                // With two-factor authentication the login finishes with a code from the app
+                if (data.mfaRequired) {
+                    const code = window.prompt('Enter the code from your authenticator app, or a recovery code');
+                    if (!code) {
+                        setFormError('A two-factor code is required to log in');
+                        return;
+                    }
+                    const mfaResponse = await fetch(`${API_BASE_URL}/api/v1/auth/login/2fa`, {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json',
+                            'Authorization': `Bearer ${data.mfaToken}`,
+                        },
+                        body: JSON.stringify({ code }),
+                    });
+                    const mfaData = await mfaResponse.json();
+                    if (!mfaResponse.ok) {
+                        setFormError(mfaData.message || 'Two-factor login failed');
+                        return;
+                    }
+                    token = mfaData.token;
+                }
+
+                setAuthToken(token);
+                localStorage.setItem('auth-token', token);
 
                 const userResponse = await fetch(`${API_BASE_URL}/api/me`, {
                     method: 'GET',
                     headers: {
-                        'Authorization': `Bearer ${data.token}`,
+                        'Authorization': `Bearer ${token}`,
                     },
                 });
 
@@ -305,8 +330,8 @@ const LoginSignup = () => {
 
                 navigate('/');
             } else {
-                const errorText = await response.text();
-                setFormError(errorText || 'Verification failed. Please try again.');
+                const errorData = await response.json().catch(() => ({}));
+                setFormError(errorData.message || 'Verification failed. Please try again.');
             }
         } catch (error) {
             console.error('Verification Error:', error);
@@ -375,8 +400,8 @@ const LoginSignup = () => {
                 setResendError('');
                 setResendSuccess('');
             } else {
-                const errorText = await response.text();
-                setFormError(errorText || 'Failed to reset password. Please try again.');
+                const errorData = await response.json().catch(() => ({}));
+                setFormError(errorData.message || 'Failed to reset password. Please try again.');
             }
         } catch (error) {
             console.error('Reset Password Error:', error);
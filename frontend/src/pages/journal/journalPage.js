@@ -114,7 +114,7 @@ const handleSaveJournal = async () => {
         return; // Prevent creating a new entry
     }
 
-    const journalData = { email: user.email, date: selectedDate, content }; // Prepare journal data
+    const journalData = { date: selectedDate, content }; // Prepare journal data
 
     try {
         const response = await fetch(`${API_BASE_URL}/api/journal/save`, {
@@ -0,0 +1,158 @@
+// File: frontend/src/pages/links/LinkPage.js
+import React, { useContext, useEffect, useRef, useState } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import '../../components/loginsignup/LoginSignup.css';
+import { API_BASE_URL } from '../../App';
+import { AuthContext } from '../../AuthContext/AuthContext';
+
+// The emailed links open /links/{verify-email,password-reset,login}?token=...; each page
+// posts the token to the matching API endpoint. A token works once.
+const endpoints = {
+    'verify-email': '/api/v1/auth/verify-email/link',
+    'password-reset': '/api/v1/auth/reset-password/link',
+    'login': '/api/v1/auth/login/link/finish',
+};
+
+const titles = {
+    'verify-email': 'Verify Email',
+    'password-reset': 'Reset Password',
+    'login': 'Log In',
+};
+
+const LinkPage = ({ purpose }) => {
+    const [searchParams] = useSearchParams();
+    const token = searchParams.get('token') || '';
+    const { setUser, setAuthToken } = useContext(AuthContext);
+    const navigate = useNavigate();
+
+    const [newPassword, setNewPassword] = useState('');
+    const [error, setError] = useState('');
+    const [success, setSuccess] = useState('');
+    const [isSending, setIsSending] = useState(false);
+
+    // Effects run twice in development (StrictMode); the token must only be posted once
+    const posted = useRef(false);
+
+    const post = async (body) => {
+        const response = await fetch(`${API_BASE_URL}${endpoints[purpose]}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ token, ...body }),
+        });
+        const data = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            throw new Error(data.message || 'This link could not be used. Please request a new one.');
+        }
+        return data;
+    };
+
+    // Store the token and user like a normal login and go to the front page
+    const finishLogin = async (data) => {
+        let authToken = data.token;
+
+        // With two-factor authentication the login finishes with a code from the app
+        if (data.mfaRequired) {
+            const code = window.prompt('Enter the code from your authenticator app, or a recovery code');
+            if (!code) {
+                throw new Error('A two-factor code is required to log in');
+            }
+            const mfaResponse = await fetch(`${API_BASE_URL}/api/v1/auth/login/2fa`, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${data.mfaToken}`,
+                },
+                body: JSON.stringify({ code }),
+            });
+            const mfaData = await mfaResponse.json().catch(() => ({}));
+            if (!mfaResponse.ok) {
+                throw new Error(mfaData.message || 'Two-factor login failed');
+            }
+            authToken = mfaData.token;
+        }
+
+        setAuthToken(authToken);
+        localStorage.setItem('auth-token', authToken);
+
+        const userResponse = await fetch(`${API_BASE_URL}/api/v1/me`, {
+            method: 'GET',
+            headers: {
+                'Authorization': `Bearer ${authToken}`,
+            },
+        });
+        if (userResponse.ok) {
+            const userData = await userResponse.json();
+            setUser(userData);
+            localStorage.setItem('user', JSON.stringify(userData));
+        }
+        navigate('/');
+    };
+
+    // Verification and login links are used as soon as the page opens
+    useEffect(() => {
+        if (purpose === 'password-reset' || posted.current) {
+            return;
+        }
+        posted.current = true;
+        if (!token) {
+            setError('This link is incomplete. Please copy the whole link from the email.');
+            return;
+        }
+
+        setIsSending(true);
+        post({})
+            .then(finishLogin)
+            .catch((err) => setError(err.message))
+            .finally(() => setIsSending(false));
+        // eslint-disable-next-line react-hooks/exhaustive-deps
+    }, [purpose, token]);
+
+    const handleResetPassword = async () => {
+        setError('');
+        setIsSending(true);
+        try {
+            await post({ newPassword });
+            setSuccess('Your password has been reset. You can now log in with it.');
+            setNewPassword('');
+        } catch (err) {
+            setError(err.message);
+        } finally {
+            setIsSending(false);
+        }
+    };
+
+    return (
+        <div className="login-signup-container">
+            <h1>{titles[purpose]}</h1>
+            {error && <div className="error-message">{error}</div>}
+            {success && <div className="success-message">{success}</div>}
+
+            {purpose === 'password-reset' && !success && (
+                <>
+                    <p>Choose a new password:</p>
+                    <input
+                        type="password"
+                        name="newPassword"
+                        value={newPassword}
+                        onChange={(e) => setNewPassword(e.target.value)}
+                        placeholder="New password"
+                    />
+                    <button onClick={handleResetPassword} disabled={isSending || !token || !newPassword}>
+                        Reset Password
+                    </button>
+                </>
+            )}
+            {purpose !== 'password-reset' && isSending && <p>Checking your link...</p>}
+
+            {(error || success) && (
+                <span className="link-text" onClick={() => navigate('/login')}>
+                    Go to login
+                </span>
+            )}
+        </div>
+    );
+};
+
+export default LinkPage;